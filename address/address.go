@@ -0,0 +1,162 @@
+// Package address converts the addresses between the hex format and the NEW format
+// of NewChain, which is NEW followed by the base58check encoding of the chain ID
+// and the address with the version byte 0, such as NEW182... of chain 1012.
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Prefix is the prefix of the NEW addresses
+const Prefix = "NEW"
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	version        = 0x00 // the base58check version byte
+	checksumLength = 4
+	maxChainIDSize = 4 // the chain ID is truncated to 32 bits
+)
+
+var (
+	ErrInvalidPrefix   = errors.New("NEW address without prefix NEW")
+	ErrInvalidBase58   = errors.New("NEW address with invalid base58 character")
+	ErrInvalidChecksum = errors.New("NEW address with invalid checksum")
+	ErrInvalidLength   = errors.New("NEW address with invalid length")
+	ErrInvalidVersion  = errors.New("NEW address with invalid version")
+)
+
+var base58Index = func() [256]int {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		index[base58Alphabet[i]] = i
+	}
+	return index
+}()
+
+// chainIDBytes returns the big endian chain ID without the leading zero bytes, at least one byte
+func chainIDBytes(chainID uint64) []byte {
+	b := new(big.Int).SetUint64(chainID & 0xFFFFFFFF).Bytes()
+	if len(b) == 0 {
+		return []byte{0}
+	}
+	return b
+}
+
+// ToNEW encodes the address of the chain in the NEW format
+func ToNEW(address common.Address, chainID uint64) string {
+	payload := append([]byte{version}, chainIDBytes(chainID)...)
+	payload = append(payload, address.Bytes()...)
+	return Prefix + base58Encode(append(payload, checksum(payload)...))
+}
+
+// FromNEW decodes the NEW address, and returns the address with the chain ID of it
+func FromNEW(s string) (common.Address, uint64, error) {
+	if !strings.HasPrefix(s, Prefix) {
+		return common.Address{}, 0, ErrInvalidPrefix
+	}
+	b, err := base58Decode(s[len(Prefix):])
+	if err != nil {
+		return common.Address{}, 0, err
+	}
+	if len(b) <= 1+checksumLength+common.AddressLength || len(b) > 1+checksumLength+common.AddressLength+maxChainIDSize {
+		return common.Address{}, 0, ErrInvalidLength
+	}
+	payload, sum := b[:len(b)-checksumLength], b[len(b)-checksumLength:]
+	if !bytes.Equal(checksum(payload), sum) {
+		return common.Address{}, 0, ErrInvalidChecksum
+	}
+	if payload[0] != version {
+		return common.Address{}, 0, ErrInvalidVersion
+	}
+	payload = payload[1:]
+
+	chainID := new(big.Int).SetBytes(payload[:len(payload)-common.AddressLength]).Uint64()
+	return common.BytesToAddress(payload[len(payload)-common.AddressLength:]), chainID, nil
+}
+
+// FromNEWOfChain decodes the NEW address, and checks it is of the chain
+func FromNEWOfChain(s string, chainID uint64) (common.Address, error) {
+	address, id, err := FromNEW(s)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if id != chainID&0xFFFFFFFF {
+		return common.Address{}, fmt.Errorf("NEW address of chain %d, want %d", id, chainID)
+	}
+	return address, nil
+}
+
+// IsNEWAddress checks whether the string is a valid NEW address
+func IsNEWAddress(s string) bool {
+	_, _, err := FromNEW(s)
+	return err == nil
+}
+
+// Parse parses the address in the hex or the NEW format
+func Parse(s string) (common.Address, error) {
+	if strings.HasPrefix(s, Prefix) {
+		address, _, err := FromNEW(s)
+		return address, err
+	}
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid address %s", s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+// checksum returns the first bytes of the double SHA-256 of the payload
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:checksumLength]
+}
+
+func base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(int64(len(base58Alphabet))), new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// each leading zero byte is encoded as the first character
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	x, base := new(big.Int), big.NewInt(int64(len(base58Alphabet)))
+	for i := 0; i < len(s); i++ {
+		digit := base58Index[s[i]]
+		if digit < 0 {
+			return nil, ErrInvalidBase58
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(digit)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
@@ -0,0 +1,119 @@
+package address
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		hex, base58 string
+	}{
+		{"", ""},
+		{"00", "1"},
+		{"0000", "11"},
+		{"48656c6c6f20576f726c6421", "2NEpo7TZRRrLZSi2U"},
+		// the base58check of the bitcoin address
+		{"00010966776006953d5567439e5e39f86a0d273beed61967f6", "16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM"},
+	}
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.hex)
+		if s := base58Encode(b); s != test.base58 {
+			t.Errorf("encode %s mismatch: have %s, want %s", test.hex, s, test.base58)
+		}
+		d, err := base58Decode(test.base58)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(d) != test.hex {
+			t.Errorf("decode %s mismatch: have %x, want %s", test.base58, d, test.hex)
+		}
+	}
+
+	payload, _ := hex.DecodeString("00010966776006953d5567439e5e39f86a0d273bee")
+	if sum := hex.EncodeToString(checksum(payload)); sum != "d61967f6" {
+		t.Errorf("checksum mismatch: have %s, want %s", sum, "d61967f6")
+	}
+}
+
+func TestNEWAddress(t *testing.T) {
+	address := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+	for _, chainID := range []uint64{0, 1, 1007, 1012, 16888, 0xFFFFFFFF} {
+		s := ToNEW(address, chainID)
+		if s[:len(Prefix)] != Prefix || !IsNEWAddress(s) {
+			t.Errorf("NEW address %s of chain %d invalid", s, chainID)
+		}
+		decoded, id, err := FromNEW(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != address || id != chainID {
+			t.Errorf("decode %s mismatch: have %s of chain %d, want %s of chain %d", s, decoded.Hex(), id, address.Hex(), chainID)
+		}
+		if parsed, err := Parse(s); err != nil || parsed != address {
+			t.Errorf("parse %s mismatch: have %s, %v", s, parsed.Hex(), err)
+		}
+		if _, err := FromNEWOfChain(s, chainID+1); err == nil {
+			t.Errorf("NEW address %s of chain %d accepted for chain %d", s, chainID, chainID+1)
+		}
+	}
+
+	s := ToNEW(address, 1012)
+	for _, invalid := range []string{
+		s[len(Prefix):],
+		s[:len(s)-1],
+		s[:len(s)-1] + "1",
+		s + "0",
+		Prefix + "1",
+	} {
+		if IsNEWAddress(invalid) {
+			t.Errorf("invalid NEW address %s accepted", invalid)
+		}
+	}
+
+	if parsed, err := Parse(address.Hex()); err != nil || parsed != address {
+		t.Errorf("parse hex mismatch: have %s, %v", parsed.Hex(), err)
+	}
+	if _, err := Parse("0x1234"); err == nil {
+		t.Errorf("invalid hex address accepted")
+	}
+}
+
+func TestNEWAddressVectors(t *testing.T) {
+	tests := []struct {
+		hex     string
+		chainID uint64
+		new     string
+	}{
+		// the NEW addresses of the testnet (1007) and the mainnet (1012) begin with NEW17z and NEW182
+		{"0x97549e368acafdcae786bb93d98379f1d1561a29", 1007, "NEW17zS9ZvgGV1EaT8KT2tLjqRvQbcApjFot8xj"},
+		{"0x0000000000000000000000000000000000000000", 1007, "NEW17zCMQXMA7yfdJYUQEeUQwKG6DnyStvX93a5"},
+		{"0xffffffffffffffffffffffffffffffffffffffff", 1007, "NEW17zbh1WTTQgr6BMuYKftkFoPN1RUhqY5u3Gi"},
+		{"0x97549e368acafdcae786bb93d98379f1d1561a29", 1012, "NEW182SqarDkvZ8tqDV9U1SQRrYmXkh7Sn97RQa"},
+		{"0x0000000000000000000000000000000000000000", 1012, "NEW182D3RSteZXZwgde6fma5XjtT9wVjcWuLuFK"},
+		{"0xffffffffffffffffffffffffffffffffffffffff", 1012, "NEW182cP2RzwrEkQZT5EknzQrE1iwZzzZ6rx38P"},
+	}
+	for _, test := range tests {
+		address := common.HexToAddress(test.hex)
+		if s := ToNEW(address, test.chainID); s != test.new {
+			t.Errorf("encode %s of chain %d mismatch: have %s, want %s", test.hex, test.chainID, s, test.new)
+		}
+		decoded, id, err := FromNEW(test.new)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != address || id != test.chainID {
+			t.Errorf("decode %s mismatch: have %s of chain %d, want %s of chain %d", test.new, decoded.Hex(), id, test.hex, test.chainID)
+		}
+	}
+
+	// the payload of another version byte is rejected
+	address := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+	payload := append(chainIDBytes(1012), address.Bytes()...)
+	payload = append([]byte{0x01}, payload...)
+	if _, _, err := FromNEW(Prefix + base58Encode(append(payload, checksum(payload)...))); err != ErrInvalidVersion {
+		t.Errorf("version error mismatch: have %v, want %v", err, ErrInvalidVersion)
+	}
+}
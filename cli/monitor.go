@@ -40,6 +40,15 @@ func (cli *CLI) buildMonitorCmd() *cobra.Command {
 				logger.Errorln(err)
 				return
 			}
+			if p.Outbox == "" {
+				p.Outbox = ".MonitorOutbox"
+			}
+			switch p.StatusTopic {
+			case "":
+				p.StatusTopic = fmt.Sprintf("%sstatus/monitor%d", p.PrefixTopic, blockDelay+1)
+			case "-":
+				p.StatusTopic = ""
+			}
 
 			enableTracer := viper.GetBool("EnableTracer")
 
@@ -64,13 +73,20 @@ func (cli *CLI) buildMonitorCmd() *cobra.Command {
 				logger.Errorln(err)
 				return
 			}
+			n.Version = cli.version
+			stopSinks, err := addSinks(&n.Notify, fmt.Sprintf("monitor%d", blockDelay+1), logger)
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			defer stopSinks()
 
 			b, err := json.MarshalIndent(n, "", "\t")
 			if err != nil {
 				logger.Errorln(err)
 				return
 			}
-			logger.Printf("ActiveMQ Info is as follow: \n%s", b)
+			logger.Printf("Broker Info is as follow: \n%s", b)
 
 			if err := n.Run(); err != nil {
 				logger.Errorln(err)
@@ -105,12 +121,34 @@ func getMonitorNotifyConfig(p string, delayBlock int64) (*notify.NotifyConfig, e
 
 	prefixTopic := viper.GetString(p + ".PrefixTopic")
 
+	mqttVersion := viper.GetInt(p + ".MQTTVersion")
+	if !(mqttVersion == 0 || mqttVersion == 3 || mqttVersion == 4 || mqttVersion == notify.MQTT5) {
+		return nil, fmt.Errorf("%s MQTTVersion only 3,4,5", p)
+	}
+
 	return &notify.NotifyConfig{
-		Server:      server,
-		Username:    username,
-		Password:    password,
-		ClientID:    clientID,
-		QoS:         byte(qos),
-		PrefixTopic: prefixTopic,
+		Server:                 server,
+		Username:               username,
+		Password:               password,
+		ClientID:               clientID,
+		QoS:                    byte(qos),
+		PrefixTopic:            prefixTopic,
+		JetStream:              viper.GetString(p + ".JetStream"),
+		Exchange:               viper.GetString(p + ".Exchange"),
+		CAFile:                 viper.GetString(p + ".CAFile"),
+		CertFile:               viper.GetString(p + ".CertFile"),
+		KeyFile:                viper.GetString(p + ".KeyFile"),
+		ServerName:             viper.GetString(p + ".ServerName"),
+		InsecureSkipVerify:     viper.GetBool(p + ".InsecureSkipVerify"),
+		MQTTVersion:            uint(mqttVersion),
+		MessageExpiry:          viper.GetDuration(p + ".MessageExpiry"),
+		ChainID:                viper.GetUint64("ChainID"),
+		PublishTimeout:         viper.GetDuration(p + ".PublishTimeout"),
+		Outbox:                 viper.GetString(p + ".Outbox"),
+		StatusTopic:            viper.GetString(p + ".StatusTopic"),
+		StatusInterval:         viper.GetDuration(p + ".StatusInterval"),
+		TopicTemplate:          viper.GetString(p + ".TopicTemplate"),
+		ContractCreateTemplate: viper.GetString(p + ".ContractCreateTemplate"),
+		NEWAddress:             viper.GetBool(p + ".NEWAddress"),
 	}, nil
 }
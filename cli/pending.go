@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -40,18 +42,39 @@ func (cli *CLI) buildPendingCmd() *cobra.Command {
 				logger.Errorln(err)
 				return
 			}
-			n, err := notify.NewPendingNotify(s, p, logger)
+			if p.Outbox == "" {
+				p.Outbox = ".PendingOutbox"
+			}
+			switch p.StatusTopic {
+			case "":
+				p.StatusTopic = p.PrefixTopic + "status/pending"
+			case "-":
+				p.StatusTopic = ""
+			}
+			nodePending, err := getNodePendingConfig()
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			n, err := notify.NewPendingNotify(s, p, cli.rpcURL, nodePending, logger)
 			if err != nil {
 				logger.Errorln(err)
 				return
 			}
+			n.Version = cli.version
+			stopSinks, err := addSinks(&n.Notify, "pending", logger)
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			defer stopSinks()
 
 			b, err := json.MarshalIndent(n, "", "\t")
 			if err != nil {
 				logger.Errorln(err)
 				return
 			}
-			logger.Printf("ActiveMQ Info is as follow: \n%s", b)
+			logger.Printf("Broker Info is as follow: \n%s", b)
 
 			if err := n.Run(); err != nil {
 				logger.Errorln(err)
@@ -96,13 +119,72 @@ func getPendingNotifyConfig(p string) (*notify.NotifyConfig, error) {
 
 	prefixTopic := viper.GetString(p + ".PrefixTopic")
 
+	var format string
+	if p == "Subscribe" {
+		format = viper.GetString(p + ".Format")
+		if format == "" {
+			format = notify.RawFormatAuto
+		}
+		if !stringInSlice(format, notify.RawFormats) {
+			return nil, fmt.Errorf("%s format only %s", p, strings.Join(notify.RawFormats, ","))
+		}
+	}
+
+	mqttVersion := viper.GetInt(p + ".MQTTVersion")
+	if !(mqttVersion == 0 || mqttVersion == 3 || mqttVersion == 4 || mqttVersion == notify.MQTT5) {
+		return nil, fmt.Errorf("%s MQTTVersion only 3,4,5", p)
+	}
+
 	return &notify.NotifyConfig{
-		Server:      server,
-		Username:    username,
-		Password:    password,
-		ClientID:    clientID,
-		QoS:         byte(qos),
-		Topic:       topic,
-		PrefixTopic: prefixTopic,
+		Server:                 server,
+		Username:               username,
+		Password:               password,
+		ClientID:               clientID,
+		QoS:                    byte(qos),
+		Topic:                  topic,
+		PrefixTopic:            prefixTopic,
+		JetStream:              viper.GetString(p + ".JetStream"),
+		Exchange:               viper.GetString(p + ".Exchange"),
+		CAFile:                 viper.GetString(p + ".CAFile"),
+		CertFile:               viper.GetString(p + ".CertFile"),
+		KeyFile:                viper.GetString(p + ".KeyFile"),
+		ServerName:             viper.GetString(p + ".ServerName"),
+		InsecureSkipVerify:     viper.GetBool(p + ".InsecureSkipVerify"),
+		MQTTVersion:            uint(mqttVersion),
+		MessageExpiry:          viper.GetDuration(p + ".MessageExpiry"),
+		ChainID:                viper.GetUint64("ChainID"),
+		PublishTimeout:         viper.GetDuration(p + ".PublishTimeout"),
+		Outbox:                 viper.GetString(p + ".Outbox"),
+		StatusTopic:            viper.GetString(p + ".StatusTopic"),
+		StatusInterval:         viper.GetDuration(p + ".StatusInterval"),
+		TopicTemplate:          viper.GetString(p + ".TopicTemplate"),
+		ContractCreateTemplate: viper.GetString(p + ".ContractCreateTemplate"),
+		NEWAddress:             viper.GetBool(p + ".NEWAddress"),
+		CleanSession:           viper.GetBool(p + ".CleanSession"),
+		ConnectRetries:         viper.GetInt(p + ".ConnectRetries"),
+		MaxReconnectInterval:   viper.GetDuration(p + ".MaxReconnectInterval"),
+		Format:                 format,
 	}, nil
 }
+
+func getNodePendingConfig() (*notify.NodePendingConfig, error) {
+	mode := viper.GetString("NodePending")
+	if mode == "" {
+		return nil, nil
+	}
+	if mode != notify.NodePendingSubscribe && mode != notify.NodePendingTxPool {
+		return nil, fmt.Errorf("NodePending only %s or %s", notify.NodePendingSubscribe, notify.NodePendingTxPool)
+	}
+
+	config := &notify.NodePendingConfig{Mode: mode}
+	interval := viper.GetString("NodePendingInterval")
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		config.Interval = d
+	}
+
+	return config, nil
+}
@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/newtonproject/newchain-notify/notify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultWebhookMaxRetries = 3
+	serverShutdownTimeout    = 5 * time.Second
+)
+
+// addSinks adds the publishers configured besides MQTT to the notify, and serves the
+// streaming servers of the service. The returned stop function shuts the servers down,
+// which are also shut down if it fails.
+func addSinks(n *notify.Notify, service string, logger *logrus.Logger) (stop func(), err error) {
+	var grpcServer *grpc.Server
+	var httpServers []*http.Server
+	stop = func() {
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		for _, s := range httpServers {
+			if err := s.Shutdown(ctx); err != nil {
+				s.Close()
+			}
+		}
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	webhook, err := getWebhookConfig()
+	if err != nil {
+		return nil, err
+	}
+	if webhook != nil {
+		p, err := notify.NewWebhookPublisher(webhook, logger)
+		if err != nil {
+			return nil, err
+		}
+		n.AddSink(p)
+	}
+
+	kafka, err := getKafkaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if kafka != nil {
+		p, err := notify.NewKafkaPublisher(kafka)
+		if err != nil {
+			return nil, err
+		}
+		n.AddSink(p)
+	}
+
+	redis, err := getRedisConfig()
+	if err != nil {
+		return nil, err
+	}
+	if redis != nil {
+		p, err := notify.NewRedisPublisher(redis)
+		if err != nil {
+			return nil, err
+		}
+		n.AddSink(p)
+	}
+
+	// the streaming servers share the hub, which is added as a sink once
+	var hub *notify.Hub
+	getHub := func() *notify.Hub {
+		if hub == nil {
+			hub = notify.NewHub(viper.GetString("Publish.PrefixTopic"), viper.GetInt("EventHistory"))
+			n.AddSink(hub)
+		}
+		return hub
+	}
+
+	grpcConfig, err := getGRPCConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	if grpcConfig != nil {
+		if grpcServer, err = notify.ServeGRPC(grpcConfig, getHub(), logger); err != nil {
+			return nil, err
+		}
+	}
+
+	wsConfig, err := getWebSocketConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	if wsConfig != nil {
+		s, err := notify.ServeWebSocket(wsConfig, getHub(), logger)
+		if err != nil {
+			return nil, err
+		}
+		httpServers = append(httpServers, s)
+	}
+
+	sseConfig, err := getSSEConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	if sseConfig != nil {
+		s, err := notify.ServeSSE(sseConfig, getHub(), logger)
+		if err != nil {
+			return nil, err
+		}
+		httpServers = append(httpServers, s)
+	}
+
+	metricsConfig, err := getMetricsConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	if metricsConfig != nil {
+		s, err := notify.ServeMetrics(metricsConfig, logger)
+		if err != nil {
+			return nil, err
+		}
+		httpServers = append(httpServers, s)
+	}
+
+	return stop, nil
+}
+
+// getListenAddr returns the address the service listens on for the section, which is
+// the one of the service in Addrs if set, so the services sharing the config listen on
+// their own addresses, otherwise Addr. It is empty if the service is not in Addrs.
+func getListenAddr(section, service string) (string, error) {
+	if viper.IsSet(section + ".Addrs") {
+		return viper.GetString(section + ".Addrs." + service), nil
+	}
+
+	addr := viper.GetString(section + ".Addr")
+	if addr == "" {
+		return "", fmt.Errorf("%s Addr is empty", section)
+	}
+	return addr, nil
+}
+
+func getMetricsConfig(service string) (*notify.MetricsConfig, error) {
+	if !viper.IsSet("Metrics") {
+		return nil, nil
+	}
+
+	addr, err := getListenAddr("Metrics", service)
+	if addr == "" || err != nil {
+		return nil, err
+	}
+
+	return &notify.MetricsConfig{Addr: addr}, nil
+}
+
+func getSSEConfig(service string) (*notify.SSEConfig, error) {
+	if !viper.IsSet("SSE") {
+		return nil, nil
+	}
+
+	addr, err := getListenAddr("SSE", service)
+	if addr == "" || err != nil {
+		return nil, err
+	}
+
+	return &notify.SSEConfig{
+		Addr:    addr,
+		Origins: viper.GetStringSlice("SSE.Origins"),
+	}, nil
+}
+
+func getWebSocketConfig(service string) (*notify.WebSocketConfig, error) {
+	if !viper.IsSet("WebSocket") {
+		return nil, nil
+	}
+
+	addr, err := getListenAddr("WebSocket", service)
+	if addr == "" || err != nil {
+		return nil, err
+	}
+
+	return &notify.WebSocketConfig{
+		Addr:    addr,
+		Origins: viper.GetStringSlice("WebSocket.Origins"),
+	}, nil
+}
+
+func getGRPCConfig(service string) (*notify.GRPCConfig, error) {
+	if !viper.IsSet("GRPC") {
+		return nil, nil
+	}
+
+	addr, err := getListenAddr("GRPC", service)
+	if addr == "" || err != nil {
+		return nil, err
+	}
+
+	return &notify.GRPCConfig{
+		Addr:     addr,
+		Tokens:   viper.GetStringSlice("GRPC.Tokens"),
+		CertFile: viper.GetString("GRPC.CertFile"),
+		KeyFile:  viper.GetString("GRPC.KeyFile"),
+		CAFile:   viper.GetString("GRPC.CAFile"),
+	}, nil
+}
+
+func getKafkaConfig() (*notify.KafkaConfig, error) {
+	if !viper.IsSet("Kafka") {
+		return nil, nil
+	}
+
+	brokers := viper.GetStringSlice("Kafka.Brokers")
+	if len(brokers) == 0 {
+		return nil, errors.New("Kafka Brokers is empty")
+	}
+
+	return &notify.KafkaConfig{
+		Brokers:     brokers,
+		ClientID:    viper.GetString("Kafka.ClientID"),
+		Version:     viper.GetString("Kafka.Version"),
+		PrefixTopic: viper.GetString("Publish.PrefixTopic"),
+	}, nil
+}
+
+func getRedisConfig() (*notify.RedisConfig, error) {
+	if !viper.IsSet("Redis") {
+		return nil, nil
+	}
+
+	addr := viper.GetString("Redis.Addr")
+	if addr == "" {
+		return nil, errors.New("Redis Addr is empty")
+	}
+
+	return &notify.RedisConfig{
+		Addr:        addr,
+		Username:    viper.GetString("Redis.Username"),
+		Password:    viper.GetString("Redis.Password"),
+		DB:          viper.GetInt("Redis.DB"),
+		Stream:      viper.GetString("Redis.Stream"),
+		KeyPrefix:   viper.GetString("Redis.KeyPrefix"),
+		MaxLen:      viper.GetInt64("Redis.MaxLen"),
+		Timeout:     viper.GetDuration("Redis.Timeout"),
+		PrefixTopic: viper.GetString("Publish.PrefixTopic"),
+	}, nil
+}
+
+func getWebhookConfig() (*notify.WebhookConfig, error) {
+	if !viper.IsSet("Webhook") {
+		return nil, nil
+	}
+
+	var routes []notify.WebhookRoute
+	if err := viper.UnmarshalKey("Webhook.Routes", &routes); err != nil {
+		return nil, err
+	}
+	if url := viper.GetString("Webhook.URL"); url != "" {
+		routes = append(routes, notify.WebhookRoute{Pattern: "#", URL: url})
+	}
+	if len(routes) == 0 {
+		return nil, errors.New("Webhook URL or Routes is empty")
+	}
+
+	maxRetries := defaultWebhookMaxRetries
+	if viper.IsSet("Webhook.MaxRetries") {
+		maxRetries = viper.GetInt("Webhook.MaxRetries")
+	}
+
+	return &notify.WebhookConfig{
+		Routes:       routes,
+		Secret:       viper.GetString("Webhook.Secret"),
+		Timeout:      viper.GetDuration("Webhook.Timeout"),
+		MaxRetries:   maxRetries,
+		RetryBackoff: viper.GetDuration("Webhook.RetryBackoff"),
+		MaxBackoff:   viper.GetDuration("Webhook.MaxBackoff"),
+		DeadLetter:   viper.GetString("Webhook.DeadLetter"),
+		Workers:      viper.GetInt("Webhook.Workers"),
+		QueueSize:    viper.GetInt("Webhook.QueueSize"),
+	}, nil
+}
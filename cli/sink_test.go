@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetListenAddr(t *testing.T) {
+	defer viper.Reset()
+
+	viper.SetConfigType("toml")
+	if err := viper.ReadConfig(strings.NewReader(`
+[GRPC]
+    Addr = "127.0.0.1:9090"
+
+[SSE]
+    [SSE.Addrs]
+        pending = "127.0.0.1:8080"
+        transfer5 = "127.0.0.1:8081"
+
+[Metrics]
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		section, service string
+		want             string
+		err              bool
+	}{
+		{"GRPC", "pending", "127.0.0.1:9090", false},
+		{"GRPC", "transfer1", "127.0.0.1:9090", false},
+		{"SSE", "pending", "127.0.0.1:8080", false},
+		{"SSE", "transfer5", "127.0.0.1:8081", false},
+		{"SSE", "monitor1", "", false},
+		{"Metrics", "pending", "", true},
+	}
+	for _, test := range tests {
+		addr, err := getListenAddr(test.section, test.service)
+		if (err != nil) != test.err {
+			t.Errorf("%s of %s: error mismatch: have %v, want error %v", test.section, test.service, err, test.err)
+		}
+		if addr != test.want {
+			t.Errorf("%s of %s: addr mismatch: have %q, want %q", test.section, test.service, addr, test.want)
+		}
+	}
+
+	// the service not in Addrs does not serve the section
+	if config, err := getSSEConfig("monitor1"); config != nil || err != nil {
+		t.Errorf("SSE config mismatch: have %v %v, want nil", config, err)
+	}
+}
@@ -2,8 +2,12 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -42,18 +46,48 @@ func (cli *CLI) buildTransferCmd() *cobra.Command {
 				logger.Errorln(err)
 				return
 			}
-			n, err := notify.NewTransferNotify(s, p, cli.rpcURL, delayBlock, logger)
+			if p.Outbox == "" {
+				p.Outbox = fmt.Sprintf(".TransferOutbox%d", delayBlock+1)
+			}
+			switch p.StatusTopic {
+			case "":
+				p.StatusTopic = fmt.Sprintf("%sstatus/transfer%d", p.PrefixTopic, delayBlock+1)
+			case "-":
+				p.StatusTopic = ""
+			}
+			confirmMode := viper.GetString("ConfirmMode")
+			if confirmMode != "" && !stringInSlice(confirmMode, notify.ConfirmModes) {
+				logger.Errorf("ConfirmMode only %s", strings.Join(notify.ConfirmModes, ","))
+				return
+			}
+			drop, err := getDropConfig()
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			queuePath := viper.GetString("QueuePath")
+			if queuePath == "" {
+				queuePath = fmt.Sprintf(".TransferQueue%d", delayBlock+1)
+			}
+			n, err := notify.NewTransferNotify(s, p, cli.rpcURL, delayBlock, confirmMode, drop, queuePath, logger)
 			if err != nil {
 				logger.Errorln(err)
 				return
 			}
+			n.Version = cli.version
+			stopSinks, err := addSinks(&n.Notify, fmt.Sprintf("transfer%d", delayBlock+1), logger)
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			defer stopSinks()
 
 			b, err := json.MarshalIndent(n, "", "\t")
 			if err != nil {
 				logger.Errorln(err)
 				return
 			}
-			logger.Printf("ActiveMQ Info is as follow: \n%s", b)
+			logger.Printf("Broker Info is as follow: \n%s", b)
 
 			if err := n.Run(); err != nil {
 				logger.Errorln(err)
@@ -101,13 +135,74 @@ func getTransferNotifyConfig(p string, delayBlock int64) (*notify.NotifyConfig,
 
 	prefixTopic := viper.GetString(p + ".PrefixTopic")
 
+	mqttVersion := viper.GetInt(p + ".MQTTVersion")
+	if !(mqttVersion == 0 || mqttVersion == 3 || mqttVersion == 4 || mqttVersion == notify.MQTT5) {
+		return nil, fmt.Errorf("%s MQTTVersion only 3,4,5", p)
+	}
+
 	return &notify.NotifyConfig{
-		Server:      server,
-		Username:    username,
-		Password:    password,
-		ClientID:    clientID,
-		QoS:         byte(qos),
-		Topic:       topic,
-		PrefixTopic: prefixTopic,
+		Server:                 server,
+		Username:               username,
+		Password:               password,
+		ClientID:               clientID,
+		QoS:                    byte(qos),
+		Topic:                  topic,
+		PrefixTopic:            prefixTopic,
+		JetStream:              viper.GetString(p + ".JetStream"),
+		Exchange:               viper.GetString(p + ".Exchange"),
+		CAFile:                 viper.GetString(p + ".CAFile"),
+		CertFile:               viper.GetString(p + ".CertFile"),
+		KeyFile:                viper.GetString(p + ".KeyFile"),
+		ServerName:             viper.GetString(p + ".ServerName"),
+		InsecureSkipVerify:     viper.GetBool(p + ".InsecureSkipVerify"),
+		MQTTVersion:            uint(mqttVersion),
+		MessageExpiry:          viper.GetDuration(p + ".MessageExpiry"),
+		ChainID:                viper.GetUint64("ChainID"),
+		PublishTimeout:         viper.GetDuration(p + ".PublishTimeout"),
+		Outbox:                 viper.GetString(p + ".Outbox"),
+		StatusTopic:            viper.GetString(p + ".StatusTopic"),
+		StatusInterval:         viper.GetDuration(p + ".StatusInterval"),
+		TopicTemplate:          viper.GetString(p + ".TopicTemplate"),
+		ContractCreateTemplate: viper.GetString(p + ".ContractCreateTemplate"),
+		NEWAddress:             viper.GetBool(p + ".NEWAddress"),
+		CleanSession:           viper.GetBool(p + ".CleanSession"),
+		ConnectRetries:         viper.GetInt(p + ".ConnectRetries"),
+		MaxReconnectInterval:   viper.GetDuration(p + ".MaxReconnectInterval"),
 	}, nil
 }
+
+func getDropConfig() (*notify.DropConfig, error) {
+	mode := viper.GetString("DropMode")
+	if mode == "" {
+		mode = notify.DropByBlock
+	}
+	drop := &notify.DropConfig{
+		Mode:  mode,
+		Topic: viper.GetString("Publish.DroppedTopic"),
+	}
+
+	after := viper.GetString("DropAfter")
+	switch mode {
+	case notify.DropByBlock:
+		if after != "" {
+			blocks, err := strconv.ParseUint(after, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("DropAfter must be the number of blocks for block mode: %v", err)
+			}
+			drop.Blocks = blocks
+		}
+	case notify.DropByTime:
+		if after == "" {
+			return nil, errors.New("DropAfter must be set for time mode")
+		}
+		timeout, err := time.ParseDuration(after)
+		if err != nil {
+			return nil, fmt.Errorf("DropAfter must be the duration for time mode: %v", err)
+		}
+		drop.Timeout = timeout
+	default:
+		return nil, fmt.Errorf("DropMode only %s", strings.Join(notify.DropModes, ","))
+	}
+
+	return drop, nil
+}
@@ -1,9 +1,50 @@
 package cli
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/newtonproject/newchain-notify/notify"
+	"github.com/spf13/viper"
+)
 
 func TestTransfer(t *testing.T) {
 	cli := NewCLI()
 
 	cli.TestCommand("transfer")
 }
+
+func TestGetDropConfig(t *testing.T) {
+	defer viper.Reset()
+
+	tests := []struct {
+		mode, after string
+		want        *notify.DropConfig
+	}{
+		{"", "", &notify.DropConfig{Mode: notify.DropByBlock}},
+		{"block", "20", &notify.DropConfig{Mode: notify.DropByBlock, Blocks: 20}},
+		{"time", "5m", &notify.DropConfig{Mode: notify.DropByTime, Timeout: 5 * time.Minute}},
+		{"block", "5m", nil},
+		{"time", "", nil},
+		{"time", "20", nil},
+		{"never", "", nil},
+	}
+	for _, test := range tests {
+		viper.Set("DropMode", test.mode)
+		viper.Set("DropAfter", test.after)
+		drop, err := getDropConfig()
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("DropMode %q DropAfter %q: want error", test.mode, test.after)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DropMode %q DropAfter %q: %v", test.mode, test.after, err)
+			continue
+		}
+		if *drop != *test.want {
+			t.Errorf("drop config mismatch: have %+v, want %+v", drop, test.want)
+		}
+	}
+}
@@ -3,24 +3,31 @@ module github.com/newtonproject/newchain-notify
 go 1.14
 
 require (
+	github.com/Shopify/sarama v1.27.2
+	github.com/alicebob/miniredis/v2 v2.17.0
 	github.com/allegro/bigcache v1.2.1 // indirect
 	github.com/aristanetworks/goarista v0.0.0-20200609010056-95bcf8053598 // indirect
 	github.com/deckarep/golang-set v1.7.1 // indirect
+	github.com/eclipse/paho.golang v0.11.0
 	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/ethereum/go-ethereum v1.8.26
 	github.com/fatih/color v1.9.0 // indirect
-	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/go-stomp/stomp/v3 v3.0.0
+	github.com/golang/protobuf v1.4.2
+	github.com/gomodule/redigo v1.8.4
 	github.com/karalabe/hid v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.7 // indirect
+	github.com/nats-io/nats.go v1.11.0
 	github.com/peterh/liner v1.2.0 // indirect
+	github.com/rabbitmq/amqp091-go v1.3.0
 	github.com/robertkrimen/otto v0.0.0-20191219234010-c382bd3c16ff // indirect
 	github.com/rs/cors v1.7.0 // indirect
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.0
-	github.com/syndtr/goleveldb v1.0.0 // indirect
-	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899 // indirect
-	golang.org/x/net v0.0.0-20200707034311-ab3426394381 // indirect
+	github.com/syndtr/goleveldb v1.0.0
+	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
 )
 
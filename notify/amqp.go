@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultAMQPExchange = "amq.topic"
+
+// amqpRoutingKey maps the topic to the routing key of the topic exchange, by the /
+// separators to dots and the MQTT wildcards + and # to * and #
+func amqpRoutingKey(topic string) string {
+	return dotTopic(topic, "*", "#")
+}
+
+func amqpExchange(c *NotifyConfig) string {
+	if c.Exchange == "" {
+		return defaultAMQPExchange
+	}
+	return c.Exchange
+}
+
+// dialAMQP connects to the AMQP server and declares the exchange of the config
+func dialAMQP(c *NotifyConfig) (*amqp.Connection, *amqp.Channel, error) {
+	config := amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Properties: amqp.Table{
+			"connection_name": c.ClientID,
+		},
+	}
+	if c.Username != "" {
+		config.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: c.Username, Password: c.Password}}
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	config.TLSClientConfig = tlsConfig
+	conn, err := amqp.DialConfig(c.Server, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	// the amq. exchanges are predeclared and can not be declared by clients
+	if exchange := amqpExchange(c); !strings.HasPrefix(exchange, "amq.") {
+		if err := ch.ExchangeDeclare(exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	return conn, ch, nil
+}
+
+// amqpPublisher publishes to the topic exchange with the routing key by the topic.
+// For QoS 1 and 2, the messages are persistent and confirmed by the broker.
+type amqpPublisher struct {
+	c      *NotifyConfig
+	redial *redial
+
+	lock   sync.Mutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	closed chan *amqp.Error // notified once the channel is closed
+}
+
+// NewAMQPPublisher connects to the AMQP server of the config, and connects again
+// with backoff when publishing after the connection is lost.
+func NewAMQPPublisher(c *NotifyConfig) (Publisher, error) {
+	p := &amqpPublisher{c: c, redial: newRedial()}
+	if _, err := p.channel(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// alive returns whether both the connection and the channel are open, as the broker
+// closes the channel alone on the channel exceptions
+func (p *amqpPublisher) alive() bool {
+	if p.conn == nil || p.conn.IsClosed() {
+		return false
+	}
+	select {
+	case <-p.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+// channel returns the confirm mode channel, connects again if the connection or the
+// channel is closed
+func (p *amqpPublisher) channel() (*amqp.Channel, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.alive() {
+		return p.ch, nil
+	}
+	if p.conn != nil && !p.conn.IsClosed() {
+		p.conn.Close()
+	}
+	if err := p.redial.allow(); err != nil {
+		return nil, err
+	}
+	conn, ch, err := dialAMQP(p.c)
+	if err == nil {
+		if err = ch.Confirm(false); err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		p.redial.failed()
+		return nil, err
+	}
+	p.redial.succeeded()
+	p.conn, p.ch = conn, ch
+	p.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	return ch, nil
+}
+
+func (p *amqpPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		Timestamp:   time.Now(),
+		Body:        payload,
+	}
+	if opts.QoS > 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	confirm, err := ch.PublishWithDeferredConfirm(amqpExchange(p.c), amqpRoutingKey(topic), false, false, msg)
+	if err != nil || opts.QoS == 0 {
+		return err
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- confirm.Wait()
+	}()
+	select {
+	case ack := <-done:
+		if !ack {
+			return errors.New("amqp message not acknowledged by the broker")
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *amqpPublisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// handleAMQPDelivery handles the delivery by f, and acknowledges it once handled or
+// requeues it if failed, unless the delivery is acknowledged by the broker already
+func (n *Notify) handleAMQPDelivery(d amqp.Delivery, durable bool, f messageHandler) {
+	if err := f(n.s.Topic, d.Body); err != nil {
+		n.Logger.Warnf("AMQP message not handled: %v", err)
+		if durable {
+			if err := d.Nack(false, true); err != nil {
+				n.Logger.Errorln(err)
+			}
+		}
+		return
+	}
+	if durable {
+		if err := d.Ack(false); err != nil {
+			n.Logger.Errorln(err)
+		}
+	}
+}
+
+// subscribeAMQP consumes the queue named by the client ID, which is bound to the
+// exchange by the routing key of the topic. For QoS 1 and 2, the queue is durable
+// and the messages are acknowledged once handled, or requeued if failed, otherwise
+// the queue is deleted after the connection is lost.
+func (n *Notify) subscribeAMQP(f messageHandler) (<-chan error, error) {
+	conn, ch, err := dialAMQP(n.s)
+	if err != nil {
+		return nil, err
+	}
+
+	durable := n.s.QoS > 0
+	queue, err := ch.QueueDeclare(n.s.ClientID, durable, !durable, false, false, nil)
+	if err == nil {
+		err = ch.QueueBind(queue.Name, amqpRoutingKey(n.s.Topic), amqpExchange(n.s), false, nil)
+	}
+	var deliveries <-chan amqp.Delivery
+	if err == nil {
+		deliveries, err = ch.Consume(queue.Name, n.s.ClientID, !durable, false, false, false, nil)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the deliveries end once the channel is closed, alone or with the connection
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	lost := make(chan error, 1)
+	go func() {
+		defer conn.Close()
+		for d := range deliveries {
+			n.handleAMQPDelivery(d, durable, f)
+		}
+		if err := <-closed; err != nil {
+			lost <- err
+			return
+		}
+		lost <- errors.New("amqp channel closed")
+	}()
+
+	return lost, nil
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestAMQPRoutingKey(t *testing.T) {
+	tests := []struct {
+		topic, key string
+	}{
+		{"RawTransaction", "RawTransaction"},
+		{"newchain/97549e368acafdcae786bb93d98379f1d1561a29/4", "newchain.97549e368acafdcae786bb93d98379f1d1561a29.4"},
+		{"newchain/+/4", "newchain.*.4"},
+		{"/newchain/#", "newchain.#"},
+	}
+	for _, tt := range tests {
+		if key := amqpRoutingKey(tt.topic); key != tt.key {
+			t.Errorf("routing key of %s: have %s, want %s", tt.topic, key, tt.key)
+		}
+	}
+	if transport := transportOf("amqps://localhost:5671/"); transport != transportAMQP {
+		t.Errorf("transport mismatch: have %s, want %s", transport, transportAMQP)
+	}
+}
+
+// recordAcknowledger records the acknowledgements of the deliveries
+type recordAcknowledger struct {
+	acks []string
+}
+
+func (a *recordAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks = append(a.acks, "ack")
+	return nil
+}
+
+func (a *recordAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		a.acks = append(a.acks, "requeue")
+	} else {
+		a.acks = append(a.acks, "nack")
+	}
+	return nil
+}
+
+func (a *recordAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.acks = append(a.acks, "reject")
+	return nil
+}
+
+func TestAMQPDeliveryAck(t *testing.T) {
+	c := &NotifyConfig{Topic: "newchain/abc/4"}
+	n := &Notify{s: c, p: c, Logger: log.New()}
+
+	tests := []struct {
+		durable bool
+		err     error
+		acks    []string
+	}{
+		{true, nil, []string{"ack"}},
+		{true, errors.New("not handled"), []string{"requeue"}},
+		{false, nil, nil},
+		{false, errors.New("not handled"), nil},
+	}
+	for _, tt := range tests {
+		a := new(recordAcknowledger)
+		handled := false
+		n.handleAMQPDelivery(amqp.Delivery{Acknowledger: a, Body: []byte(`{}`)}, tt.durable, func(topic string, payload []byte) error {
+			if topic != c.Topic {
+				t.Errorf("topic mismatch: have %s, want %s", topic, c.Topic)
+			}
+			// not acknowledged before handled
+			if len(a.acks) != 0 {
+				t.Errorf("acknowledged before handled: %v", a.acks)
+			}
+			handled = true
+			return tt.err
+		})
+		if !handled {
+			t.Errorf("delivery not handled")
+		}
+		if !reflect.DeepEqual(a.acks, tt.acks) {
+			t.Errorf("acks of durable %v and error %v: have %v, want %v", tt.durable, tt.err, a.acks, tt.acks)
+		}
+	}
+}
+
+func TestAMQPPublisherAlive(t *testing.T) {
+	p := &amqpPublisher{}
+	if p.alive() {
+		t.Errorf("alive without connection")
+	}
+
+	p.conn, p.closed = new(amqp.Connection), make(chan *amqp.Error, 1)
+	if !p.alive() {
+		t.Errorf("not alive with the open channel")
+	}
+	// the broker closes the channel alone, so that it is dialed again
+	p.closed <- &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED"}
+	if p.alive() {
+		t.Errorf("alive with the channel closed by the broker")
+	}
+}
@@ -0,0 +1,455 @@
+package notify
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-notify/queue"
+)
+
+const (
+	// maxReceiptBackoff is the max blocks between two receipt checks of a pending transaction
+	maxReceiptBackoff = 4
+	// checkRPCTimeout is the timeout of the receipt and canonical checks of each block
+	checkRPCTimeout = 10 * time.Second
+)
+
+// tracked is the queued element of a transaction
+type tracked struct {
+	id    uint64
+	txAge TxAge
+}
+
+// transferChecker keeps every transaction waiting for confirmation as one element
+// of a delay queue keyed by block number, released at the block of its next check:
+//   - pending: the block to drop it in the block confirm mode, or the next receipt
+//     check in the receipt confirm mode
+//   - included: the block at which the inclusion block is deep enough
+//   - announced: the next canonical check of the inclusion block
+//
+// So each block only does the work for the transactions due at it, and for the
+// transactions of the block itself in the block confirm mode.
+//
+// The due transactions are leased from the queue, and removed together with their
+// next checks in one batch only after their outcome is published, so that they are
+// checked again after a restart if the service stops in between.
+type transferChecker struct {
+	n      *TransaferNotify
+	q      *queue.DurableDelay
+	p      Publisher
+	window *blockWindow
+	txs    map[common.Hash]tracked
+
+	// the batch of the queue changes, and the queued transactions before them to
+	// roll back to if the batch fails, nil for the ones not queued before
+	batch   *queue.DelayBatch
+	touched map[common.Hash]*tracked
+
+	// the drop time of the pending transactions, only for the time drop mode in
+	// the block confirm mode, where the pending ones are not released by block
+	deadlines *queue.Delay
+
+	head  uint64 // the number of the latest checked block
+	watch uint64 // the blocks to watch the announced transactions
+}
+
+func newTransferChecker(n *TransaferNotify, q *queue.DurableDelay, p Publisher) *transferChecker {
+	watch := uint64(n.block + 10)
+	t := &transferChecker{
+		n:      n,
+		q:      q,
+		p:      p,
+		window: newBlockWindow(int(watch) + 1),
+		txs:    make(map[common.Hash]tracked),
+		watch:  watch,
+	}
+	if n.confirmMode != ConfirmReceipt && n.drop.Mode == DropByTime {
+		t.deadlines = queue.NewDelay()
+	}
+
+	for _, item := range q.Items() {
+		txAge := item.Data.(TxAge)
+		if prev, ok := t.txs[txAge.tx.Hash]; ok {
+			if prev.id > item.ID {
+				q.Remove(item.ID)
+				continue
+			}
+			q.Remove(prev.id)
+		}
+		t.txs[txAge.tx.Hash] = tracked{id: item.ID, txAge: txAge}
+		t.addDeadline(txAge)
+	}
+
+	return t
+}
+
+func isPending(txAge *TxAge) bool {
+	return !txAge.announced && txAge.blockNumber == nil
+}
+
+func receiptBackoff(checks uint64) uint64 {
+	if checks >= 2 {
+		return maxReceiptBackoff
+	}
+	return 1 << checks
+}
+
+func (t *transferChecker) addDeadline(txAge TxAge) {
+	if t.deadlines != nil && isPending(&txAge) {
+		t.deadlines.Push(uint64(txAge.since.Add(t.n.drop.Timeout).Unix()), txAge.tx.Hash)
+	}
+}
+
+// begin starts the batch of the queue changes
+func (t *transferChecker) begin() {
+	t.batch = t.q.NewBatch()
+	t.touched = make(map[common.Hash]*tracked)
+}
+
+// commit writes the batch of the queue changes, or rolls back the queued transactions
+// if it fails, then the leased ones are checked again at the next block
+func (t *transferChecker) commit() error {
+	batch, touched := t.batch, t.touched
+	t.batch, t.touched = nil, nil
+	if batch.Len() == 0 {
+		return nil
+	}
+	err := batch.Write()
+	if err != nil {
+		t.n.Logger.Errorln(err)
+		for hash, prev := range touched {
+			if prev == nil {
+				delete(t.txs, hash)
+				continue
+			}
+			t.txs[hash] = *prev
+		}
+	}
+	return err
+}
+
+// touch keeps the queued transaction before the changes of the batch
+func (t *transferChecker) touch(hash common.Hash) {
+	if _, ok := t.touched[hash]; ok {
+		return
+	}
+	if prev, ok := t.txs[hash]; ok {
+		t.touched[hash] = &prev
+		return
+	}
+	t.touched[hash] = nil
+}
+
+// schedule queues the transaction to be checked at the due block
+func (t *transferChecker) schedule(due uint64, txAge TxAge) {
+	t.touch(txAge.tx.Hash)
+	id, err := t.batch.Push(due, txAge)
+	if err != nil {
+		t.n.Logger.Errorln(err)
+		return
+	}
+	t.txs[txAge.tx.Hash] = tracked{id: id, txAge: txAge}
+}
+
+// schedulePending queues the pending transaction to be checked at its next check
+func (t *transferChecker) schedulePending(txAge TxAge) {
+	if t.n.confirmMode == ConfirmReceipt {
+		t.schedule(t.head+receiptBackoff(txAge.checks), txAge)
+		return
+	}
+
+	if t.n.drop.Mode == DropByTime {
+		t.schedule(math.MaxUint64, txAge)
+		t.addDeadline(txAge)
+		return
+	}
+	t.schedule(txAge.queued+t.n.drop.Blocks+1, txAge)
+}
+
+// take removes the queued transaction
+func (t *transferChecker) take(hash common.Hash) (TxAge, bool) {
+	tx, ok := t.txs[hash]
+	if !ok {
+		return TxAge{}, false
+	}
+	t.touch(hash)
+	delete(t.txs, hash)
+	t.batch.Remove(tx.id)
+
+	return t.restore(tx.txAge), true
+}
+
+// restore sets the queued block of the transaction queued by the versions before the
+// block-keyed queue, by the blocks it has been checked
+func (t *transferChecker) restore(txAge TxAge) TxAge {
+	if !txAge.restored {
+		return txAge
+	}
+	txAge.restored = false
+	if txAge.checks < t.head {
+		txAge.queued = t.head - txAge.checks
+	}
+	txAge.checks = 0
+	return txAge
+}
+
+// add queues the new transaction, and returns the error if it is not written to the queue
+func (t *transferChecker) add(tx *TransferTx) error {
+	if _, ok := t.txs[tx.Hash]; ok {
+		t.n.Logger.Debugln("transaction already queued ", tx.Hash.String())
+		return nil
+	}
+	t.begin()
+
+	txAge := TxAge{tx: tx, since: time.Now(), queued: t.head}
+	if t.n.confirmMode != ConfirmReceipt {
+		if b := t.window.Lookup(tx.Hash); b != nil {
+			txAge.blockNumber, txAge.blockHash = b.Number(), b.Hash()
+			t.schedule(t.head, txAge)
+			return t.commit()
+		}
+	}
+	t.schedulePending(txAge)
+	return t.commit()
+}
+
+// check checks the transactions due at the block
+func (t *transferChecker) check(block *types.Block) {
+	t.window.Add(block)
+	t.head = block.NumberU64()
+	now := time.Now()
+	t.begin()
+	defer t.commit()
+
+	var included, announced, polls []TxAge
+	if t.n.confirmMode != ConfirmReceipt {
+		for _, tx := range block.Transactions() {
+			if q, ok := t.txs[tx.Hash()]; !ok || !isPending(&q.txAge) {
+				continue
+			}
+			txAge, _ := t.take(tx.Hash())
+			txAge.blockNumber, txAge.blockHash = block.Number(), block.Hash()
+			included = append(included, txAge)
+		}
+	}
+
+	for _, item := range t.q.Lease(t.head) {
+		txAge := item.Data.(TxAge)
+		t.batch.Remove(item.ID)
+		if q, ok := t.txs[txAge.tx.Hash]; !ok || q.id != item.ID {
+			continue
+		}
+		t.touch(txAge.tx.Hash)
+		delete(t.txs, txAge.tx.Hash)
+		txAge = t.restore(txAge)
+
+		switch {
+		case txAge.announced:
+			announced = append(announced, txAge)
+		case txAge.blockNumber != nil:
+			included = append(included, txAge)
+		case t.n.confirmMode == ConfirmReceipt:
+			polls = append(polls, txAge)
+		case t.n.drop.expired(&txAge, t.head, now):
+			t.drop(txAge)
+		default:
+			t.schedulePending(txAge)
+		}
+	}
+
+	if t.deadlines != nil {
+		for _, item := range t.deadlines.Release(uint64(now.Unix())) {
+			hash := item.Data.(common.Hash)
+			if q, ok := t.txs[hash]; !ok || !isPending(&q.txAge) {
+				continue
+			}
+			txAge, _ := t.take(hash)
+			t.drop(txAge)
+		}
+	}
+
+	included = append(included, t.checkReceipts(polls, now)...)
+	t.checkCanonical(included, announced)
+}
+
+// checkReceipts checks the receipts of the pending transactions, returns the
+// ones whose inclusion blocks are deep enough, the others are queued again.
+func (t *transferChecker) checkReceipts(polls []TxAge, now time.Time) []TxAge {
+	if len(polls) == 0 {
+		return nil
+	}
+
+	hashes := make([]common.Hash, len(polls))
+	for i, txAge := range polls {
+		hashes[i] = txAge.tx.Hash
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkRPCTimeout)
+	defer cancel()
+	head, receipts, errs, err := getReceipts(ctx, t.n.rc, hashes)
+	if err != nil {
+		t.n.Logger.Errorln(err)
+		for _, txAge := range polls {
+			t.schedule(t.head+1, txAge)
+		}
+		return nil
+	}
+
+	var included []TxAge
+	for i, receipt := range receipts {
+		txAge := polls[i]
+		if errs[i] != nil {
+			// check again later, but never drop it by the failure
+			t.n.Logger.Errorln(errs[i], txAge.tx.Hash.String())
+			txAge.checks++
+			t.schedulePending(txAge)
+			continue
+		}
+		if receipt == nil || receipt.BlockNumber == nil {
+			if t.n.drop.expired(&txAge, t.head, now) {
+				t.drop(txAge)
+				continue
+			}
+			txAge.checks++
+			t.schedulePending(txAge)
+			continue
+		}
+
+		number := receipt.BlockNumber.ToInt()
+		status := uint64(receipt.Status)
+		txAge.blockNumber, txAge.blockHash, txAge.status = number, receipt.BlockHash, &status
+
+		// the inclusion block is deep enough when the head is n.block blocks ahead
+		depth := big.NewInt(0).Sub(head, number)
+		if depth.Cmp(big.NewInt(t.n.block)) >= 0 {
+			included = append(included, txAge)
+			continue
+		}
+		t.schedule(t.head+uint64(t.n.block)-depth.Uint64(), txAge)
+	}
+
+	return included
+}
+
+// checkCanonical announces the included transactions and watches the announced
+// ones, if their inclusion blocks are still in the canonical chain.
+func (t *transferChecker) checkCanonical(included, announced []TxAge) {
+	if len(included) == 0 && len(announced) == 0 {
+		return
+	}
+
+	numbers := make([]*big.Int, 0, len(included)+len(announced))
+	for _, txAge := range included {
+		numbers = append(numbers, txAge.blockNumber)
+	}
+	for _, txAge := range announced {
+		numbers = append(numbers, txAge.blockNumber)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkRPCTimeout)
+	defer cancel()
+	canonical, err := getCanonicalHashes(ctx, t.n.rc, numbers)
+	if err != nil {
+		t.n.Logger.Errorln(err)
+		for _, txAge := range included {
+			t.schedule(t.head+1, txAge)
+		}
+		for _, txAge := range announced {
+			t.schedule(t.head+1, txAge)
+		}
+		return
+	}
+
+	var reorged []TxAge
+	var orphans []common.Hash
+	for _, txAge := range included {
+		tx := txAge.tx
+		hash, ok := canonical[txAge.blockNumber.Uint64()]
+		if !ok {
+			// unknown yet, check again at the next block
+			t.schedule(t.head+1, txAge)
+			continue
+		}
+		if hash != txAge.blockHash {
+			t.n.Logger.Warnln("transaction included in non-canonical block ", tx.Hash.String())
+			reorged = append(reorged, TxAge{tx: tx, since: txAge.since, queued: txAge.queued})
+			orphans = append(orphans, txAge.blockHash)
+			continue
+		}
+
+		tx.BlockNumber = txAge.blockNumber
+		tx.Status = txAge.status
+		t.n.publishToBlockTopic(t.p, tx, t.n.block+1)
+
+		txAge.announced = true
+		txAge.queued = t.head
+		txAge.checks = 0
+		t.schedule(t.head+1, txAge)
+	}
+
+	for _, txAge := range announced {
+		tx := txAge.tx
+		hash, ok := canonical[txAge.blockNumber.Uint64()]
+		if !ok {
+			if t.head < txAge.queued+t.watch {
+				t.schedule(t.head+1, txAge)
+			}
+			continue
+		}
+		if hash != txAge.blockHash {
+			t.n.Logger.Warnln("transaction left canonical chain ", tx.Hash.String())
+			t.n.publishUnconfirmed(t.p, &txAge)
+			reorged = append(reorged, TxAge{tx: tx, since: txAge.since, queued: t.head})
+			orphans = append(orphans, txAge.blockHash)
+			continue
+		}
+		if t.head >= txAge.queued+t.watch {
+			continue
+		}
+
+		// check again after 1, 2, 4, ... blocks till the end of the watch
+		txAge.checks++
+		offset := t.watch
+		if txAge.checks < 64 && uint64(1)<<txAge.checks < offset {
+			offset = uint64(1) << txAge.checks
+		}
+		t.schedule(txAge.queued+offset, txAge)
+	}
+
+	t.requeue(reorged, orphans)
+}
+
+// requeue queues the transactions which left the canonical chain, out of the orphan
+// blocks, as pending again. In the block mode only the coming blocks are scanned, so
+// a transaction included by another block of the window already takes that block,
+// and the others are looked up by their receipts once before waiting for the blocks.
+func (t *transferChecker) requeue(reorged []TxAge, orphans []common.Hash) {
+	if t.n.confirmMode == ConfirmReceipt {
+		for _, txAge := range reorged {
+			t.schedulePending(txAge)
+		}
+		return
+	}
+
+	var lookups []TxAge
+	for i, txAge := range reorged {
+		if b := t.window.Lookup(txAge.tx.Hash); b != nil && b.Hash() != orphans[i] {
+			txAge.blockNumber, txAge.blockHash = b.Number(), b.Hash()
+			t.schedule(t.head+1, txAge)
+			continue
+		}
+		lookups = append(lookups, txAge)
+	}
+	// the ones deep enough are checked against the canonical chain at the next block
+	for _, txAge := range t.checkReceipts(lookups, time.Now()) {
+		t.schedule(t.head+1, txAge)
+	}
+}
+
+// drop publishes the dropped event of the pending transaction
+func (t *transferChecker) drop(txAge TxAge) {
+	t.n.Logger.Warnln("discard transaction ", txAge.tx.Hash.String())
+	t.n.publishDropped(t.p, txAge.tx)
+}
@@ -0,0 +1,524 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/newtonproject/newchain-notify/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+// EthService serves the eth methods used by the transfer checker
+type EthService struct {
+	lock        sync.Mutex
+	head        uint64
+	receipts    map[common.Hash]*txReceipt
+	receiptErrs map[common.Hash]error
+	canonical   map[uint64]common.Hash // the blocks without hash are null
+}
+
+func newEthService(head uint64) *EthService {
+	return &EthService{
+		head:        head,
+		receipts:    make(map[common.Hash]*txReceipt),
+		receiptErrs: make(map[common.Hash]error),
+		canonical:   make(map[uint64]common.Hash),
+	}
+}
+
+func (s *EthService) BlockNumber() hexutil.Uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return hexutil.Uint64(s.head)
+}
+
+func (s *EthService) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.receiptErrs[hash]; err != nil {
+		return nil, err
+	}
+	receipt, ok := s.receipts[hash]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{"blockHash": receipt.BlockHash, "blockNumber": receipt.BlockNumber, "status": receipt.Status}, nil
+}
+
+func (s *EthService) GetBlockByNumber(number hexutil.Uint64, full bool) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash, ok := s.canonical[uint64(number)]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{"number": number, "hash": hash}, nil
+}
+
+func (s *EthService) setHead(head uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.head = head
+}
+
+// include mines the transaction in the canonical block of the number
+func (s *EthService) include(hash common.Hash, number uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	blockHash := common.BigToHash(new(big.Int).SetUint64(number + 1000))
+	s.canonical[number] = blockHash
+	s.receipts[hash] = &txReceipt{BlockHash: blockHash, BlockNumber: (*hexutil.Big)(new(big.Int).SetUint64(number)), Status: 1}
+	delete(s.receiptErrs, hash)
+}
+
+// setCanonical sets the hash of the canonical block, null if empty
+func (s *EthService) setCanonical(number uint64, hash common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if hash == (common.Hash{}) {
+		delete(s.canonical, number)
+		return
+	}
+	s.canonical[number] = hash
+}
+
+func (s *EthService) failReceipt(hash common.Hash, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.receiptErrs[hash] = err
+}
+
+func newTestChecker(t *testing.T, confirmMode string, eth *EthService) (*transferChecker, *recordPublisher) {
+	q, err := queue.OpenDurableDelay("", txAgeCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	pub := new(recordPublisher)
+	return newTestQueueChecker(t, confirmMode, eth, q, pub), pub
+}
+
+func newTestQueueChecker(t *testing.T, confirmMode string, eth *EthService, q *queue.DurableDelay, pub Publisher) *transferChecker {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	c := rpc.DialInProc(server)
+	t.Cleanup(c.Close)
+
+	n := &TransaferNotify{
+		Notify:      Notify{p: &NotifyConfig{PrefixTopic: "newchain/"}, Logger: log.New()},
+		block:       3,
+		confirmMode: confirmMode,
+		drop:        &DropConfig{Mode: DropByBlock, Blocks: 13, Topic: defaultDroppedTopic},
+		rc:          c,
+	}
+	return newTransferChecker(n, q, pub)
+}
+
+func testBlock(number uint64, txs ...*types.Transaction) *types.Block {
+	return types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(number)}, txs, nil, nil)
+}
+
+func testTransferTx(hash common.Hash) *TransferTx {
+	to := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+	return &TransferTx{From: common.HexToAddress("0xe028d0363813d19d8c76886bd6b32dacf50b7a6d"), To: &to, Value: big.NewInt(1), Hash: hash}
+}
+
+// addressEvents returns the events published to the confirmation and the unconfirmed
+// topics of the address, confirmed if not set, and checks each is on its own topic
+func addressEvents(t *testing.T, pub *recordPublisher) []string {
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+
+	const prefix = "newchain/97549e368acafdcae786bb93d98379f1d1561a29/"
+	var events []string
+	for _, m := range pub.messages {
+		if m.topic != prefix+"4" && m.topic != prefix+EventUnconfirmed {
+			continue
+		}
+		var tx struct {
+			Event string `json:"event"`
+		}
+		if err := json.Unmarshal(m.payload, &tx); err != nil {
+			t.Fatal(err)
+		}
+		if tx.Event == "" {
+			tx.Event = EventConfirmed
+		}
+		want := prefix + "4"
+		if tx.Event == EventUnconfirmed {
+			want = prefix + EventUnconfirmed
+		}
+		if m.topic != want {
+			t.Errorf("%s event topic mismatch: have %s, want %s", tx.Event, m.topic, want)
+		}
+		events = append(events, tx.Event)
+	}
+	return events
+}
+
+// confirmed returns the hashes of the confirmations published to the address topic
+func confirmed(t *testing.T, pub *recordPublisher) []common.Hash {
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+
+	var hashes []common.Hash
+	for _, m := range pub.messages {
+		if m.topic != "newchain/97549e368acafdcae786bb93d98379f1d1561a29/4" {
+			continue
+		}
+		var tx struct {
+			Hash   common.Hash     `json:"hash"`
+			Status *hexutil.Uint64 `json:"status"`
+			Event  string          `json:"event"`
+		}
+		if err := json.Unmarshal(m.payload, &tx); err != nil {
+			t.Fatal(err)
+		}
+		if tx.Event == "" {
+			hashes = append(hashes, tx.Hash)
+		}
+	}
+	return hashes
+}
+
+func TestReceiptConfirm(t *testing.T) {
+	eth := newEthService(9)
+	checker, pub := newTestChecker(t, ConfirmReceipt, eth)
+	mined, pending, failed := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+
+	checker.check(testBlock(9))
+	for _, hash := range []common.Hash{mined, pending, failed} {
+		checker.add(testTransferTx(hash))
+	}
+
+	// mined before seen, and one failing receipt does not fail the others
+	eth.include(mined, 8)
+	eth.failReceipt(failed, errors.New("receipt failed"))
+	eth.setHead(13)
+	checker.check(testBlock(10))
+	if hashes := confirmed(t, pub); len(hashes) != 1 || hashes[0] != mined {
+		t.Fatalf("confirmed %v, want %s", hashes, mined.Hex())
+	}
+	if len(checker.txs) != 3 || !checker.txs[mined].txAge.announced || checker.txs[failed].txAge.blockNumber != nil {
+		t.Fatalf("queued transactions mismatch: %+v", checker.txs)
+	}
+	if status := checker.txs[mined].txAge.status; status == nil || *status != 1 {
+		t.Errorf("receipt status mismatch: %v", status)
+	}
+
+	// the failed receipt is checked again, not deep enough yet
+	eth.include(failed, 12)
+	eth.setHead(14)
+	checker.check(testBlock(11))
+	checker.check(testBlock(12))
+	if hashes := confirmed(t, pub); len(hashes) != 1 {
+		t.Fatalf("confirmed %v before deep enough", hashes)
+	}
+	eth.setHead(15)
+	for number := uint64(13); number <= 14; number++ {
+		checker.check(testBlock(number))
+	}
+	if hashes := confirmed(t, pub); len(hashes) != 2 || hashes[1] != failed {
+		t.Fatalf("confirmed %v, want %s", hashes, failed.Hex())
+	}
+
+	// never mined, dropped after the blocks
+	for number := uint64(15); number <= 24; number++ {
+		checker.check(testBlock(number))
+	}
+	if _, ok := checker.txs[pending]; ok {
+		t.Fatal("pending transaction not dropped")
+	}
+	if topics := pub.topics(); topics[len(topics)-1] != defaultDroppedTopic {
+		t.Errorf("dropped topic mismatch: %v", topics)
+	}
+}
+
+func TestCanonicalCheck(t *testing.T) {
+	eth := newEthService(13)
+	checker, pub := newTestChecker(t, ConfirmReceipt, eth)
+	hash := common.HexToHash("0x01")
+	checkEvents := func(want ...string) {
+		t.Helper()
+		events := addressEvents(t, pub)
+		if len(events) != len(want) {
+			t.Fatalf("events mismatch: have %v, want %v", events, want)
+		}
+		for i := range events {
+			if events[i] != want[i] {
+				t.Fatalf("events mismatch: have %v, want %v", events, want)
+			}
+		}
+	}
+
+	checker.check(testBlock(9))
+	checker.add(testTransferTx(hash))
+	eth.include(hash, 8)
+	canonical := eth.canonical[8]
+
+	// the null header is unknown, neither confirmed nor reorged
+	eth.setCanonical(8, common.Hash{})
+	checker.check(testBlock(10))
+	checker.check(testBlock(11))
+	checkEvents()
+	if txAge := checker.txs[hash].txAge; txAge.blockNumber == nil || txAge.announced {
+		t.Fatalf("included transaction mismatch: %+v", txAge)
+	}
+	eth.setCanonical(8, canonical)
+	checker.check(testBlock(12))
+	checkEvents(EventConfirmed)
+
+	// watched after announced, the null header is not a reorg
+	checker.check(testBlock(13))
+	eth.setCanonical(8, common.Hash{})
+	checker.check(testBlock(14))
+	checkEvents(EventConfirmed)
+	if !checker.txs[hash].txAge.announced {
+		t.Fatal("announced transaction not watched")
+	}
+
+	// the block leaves the canonical chain
+	eth.setCanonical(8, common.HexToHash("0xff"))
+	checker.check(testBlock(15))
+	checkEvents(EventConfirmed, EventUnconfirmed)
+	if txAge := checker.txs[hash].txAge; !isPending(&txAge) {
+		t.Fatalf("reorged transaction not pending: %+v", txAge)
+	}
+
+	// and confirmed again in the new block
+	eth.include(hash, 9)
+	eth.setHead(16)
+	checker.check(testBlock(16))
+	checkEvents(EventConfirmed, EventUnconfirmed, EventConfirmed)
+
+	// the included transaction in the non-canonical block is not confirmed
+	other := common.HexToHash("0x02")
+	checker.add(testTransferTx(other))
+	eth.include(other, 10)
+	eth.setCanonical(10, common.HexToHash("0xff"))
+	eth.setHead(20)
+	checker.check(testBlock(17))
+	checkEvents(EventConfirmed, EventUnconfirmed, EventConfirmed)
+	if txAge := checker.txs[other].txAge; !isPending(&txAge) {
+		t.Fatalf("non-canonical transaction not pending: %+v", txAge)
+	}
+}
+
+func TestBlockConfirm(t *testing.T) {
+	eth := newEthService(0)
+	checker, pub := newTestChecker(t, ConfirmBlock, eth)
+	txs := newSignedTransactions(t, 2)
+	mined, pending := txs[0].Hash(), txs[1].Hash()
+
+	checker.check(testBlock(9))
+	checker.add(testTransferTx(mined))
+	checker.add(testTransferTx(pending))
+
+	// confirmed by the block which includes it, if canonical
+	block := testBlock(10, txs[0])
+	eth.setCanonical(10, block.Hash())
+	checker.check(block)
+	if events := addressEvents(t, pub); len(events) != 1 || events[0] != EventConfirmed {
+		t.Fatalf("events mismatch: %v", events)
+	}
+	if txAge := checker.txs[mined].txAge; !txAge.announced || txAge.blockNumber.Uint64() != 10 {
+		t.Fatalf("announced transaction mismatch: %+v", txAge)
+	}
+
+	// watched till the end, and the pending one dropped after the blocks
+	for number := uint64(11); number < 23; number++ {
+		checker.check(testBlock(number))
+	}
+	if len(checker.txs) != 2 {
+		t.Fatalf("queued transactions mismatch: %+v", checker.txs)
+	}
+	checker.check(testBlock(23))
+	if len(checker.txs) != 0 {
+		t.Fatalf("queued transactions after the watch and the drop: %+v", checker.txs)
+	}
+	if events := addressEvents(t, pub); len(events) != 1 {
+		t.Errorf("events mismatch: %v", events)
+	}
+	if topics := pub.topics(); topics[len(topics)-1] != defaultDroppedTopic {
+		t.Errorf("dropped topic mismatch: %v", topics)
+	}
+	if checker.q.Size() != 0 {
+		t.Errorf("queue size mismatch: have %d, want 0", checker.q.Size())
+	}
+}
+
+func TestBlockReorg(t *testing.T) {
+	eth := newEthService(0)
+	checker, pub := newTestChecker(t, ConfirmBlock, eth)
+	txs := newSignedTransactions(t, 1)
+	hash := txs[0].Hash()
+
+	checker.check(testBlock(9))
+	checker.add(testTransferTx(hash))
+	block := testBlock(10, txs[0])
+	eth.setCanonical(10, block.Hash())
+	checker.check(block)
+
+	// the new chain includes it at the next block, which is scanned while announced
+	reorged := testBlock(11, txs[0])
+	eth.setCanonical(11, reorged.Hash())
+	checker.check(reorged)
+	eth.setCanonical(10, common.HexToHash("0xff"))
+	checker.check(testBlock(12))
+	if events := addressEvents(t, pub); len(events) != 2 || events[1] != EventUnconfirmed {
+		t.Fatalf("events mismatch: %v", events)
+	}
+	if txAge := checker.txs[hash].txAge; txAge.blockNumber == nil || txAge.blockNumber.Uint64() != 11 {
+		t.Fatalf("reorged transaction not found in the window: %+v", txAge)
+	}
+
+	// confirmed again by the block of the window, not dropped
+	checker.check(testBlock(13))
+	if events := addressEvents(t, pub); len(events) != 3 || events[2] != EventConfirmed {
+		t.Fatalf("events mismatch: %v", events)
+	}
+	for number := uint64(14); number < 30; number++ {
+		checker.check(testBlock(number))
+	}
+	if topics := pub.topics(); topics[len(topics)-1] == defaultDroppedTopic {
+		t.Errorf("reorged transaction dropped: %v", topics)
+	}
+}
+
+// crashPublisher closes the queue on publish, as the service stops before the
+// queue changes of the block are written
+type crashPublisher struct {
+	q *queue.DurableDelay
+}
+
+func (p *crashPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	p.q.Close()
+	return nil
+}
+
+func (p *crashPublisher) Close() error {
+	return nil
+}
+
+func TestCheckerRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := queue.OpenDurableDelay(dir, txAgeCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth := newEthService(13)
+	hash := common.HexToHash("0x01")
+	checker := newTestQueueChecker(t, ConfirmReceipt, eth, q, &crashPublisher{q: q})
+	checker.check(testBlock(9))
+	checker.add(testTransferTx(hash))
+	eth.include(hash, 8)
+	checker.check(testBlock(10))
+
+	// the due transaction is kept until its outcome is published
+	q, err = queue.OpenDurableDelay(dir, txAgeCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := new(recordPublisher)
+	checker = newTestQueueChecker(t, ConfirmReceipt, eth, q, pub)
+	if txAge := checker.txs[hash].txAge; len(checker.txs) != 1 || !isPending(&txAge) {
+		t.Fatalf("restored transactions mismatch: %+v", checker.txs)
+	}
+	checker.check(testBlock(10))
+	if events := addressEvents(t, pub); len(events) != 1 || events[0] != EventConfirmed {
+		t.Fatalf("events mismatch: %v", events)
+	}
+	q.Close()
+
+	// and its next check is kept once published
+	q, err = queue.OpenDurableDelay(dir, txAgeCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	checker = newTestQueueChecker(t, ConfirmReceipt, eth, q, pub)
+	if txAge := checker.txs[hash].txAge; len(checker.txs) != 1 || !txAge.announced {
+		t.Fatalf("restored transactions mismatch: %+v", checker.txs)
+	}
+}
+
+// bytesCodec keeps the bytes as they are
+type bytesCodec struct{}
+
+func (bytesCodec) Encode(data interface{}) ([]byte, error) {
+	return data.([]byte), nil
+}
+
+func (bytesCodec) Decode(b []byte) (interface{}, error) {
+	return b, nil
+}
+
+func TestCheckerRestoreLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the transaction queued by the durable queue before the block-keyed queue
+	hash := common.HexToHash("0x01")
+	tx, err := json.Marshal(testTransferTx(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := queue.OpenDurable(dir, bytesCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Push([]byte(fmt.Sprintf(`{"tx":%s,"age":5,"since":"2026-10-19T00:00:00Z"}`, tx)))
+	legacy.Push([]byte(`{"tx":null}`))
+	legacy.Close()
+
+	q, err := queue.OpenDurableDelay(dir, txAgeCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Size() != 1 || q.Corrupted() != 1 {
+		t.Fatalf("restore mismatch: size %d, corrupted %d", q.Size(), q.Corrupted())
+	}
+	checker := newTestQueueChecker(t, ConfirmBlock, newEthService(0), q, new(recordPublisher))
+
+	// queued by the blocks it has been checked
+	checker.check(testBlock(100))
+	if txAge := checker.txs[hash].txAge; txAge.queued != 95 || txAge.restored || !isPending(&txAge) {
+		t.Fatalf("restored transaction mismatch: %+v", txAge)
+	}
+	for number := uint64(101); number <= 109; number++ {
+		checker.check(testBlock(number))
+	}
+	if _, ok := checker.txs[hash]; ok {
+		t.Error("restored transaction not dropped")
+	}
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DropByBlock drops the pending transaction after it has been checked for a number of blocks
+	DropByBlock = "block"
+	// DropByTime drops the pending transaction after it has been queued for a wall-clock duration
+	DropByTime = "time"
+
+	// EventDropped is the event of the transaction dropped by the transfer
+	EventDropped = "dropped"
+	// EventUnconfirmed is the event of the confirmed transaction which left the canonical chain
+	EventUnconfirmed = "unconfirmed"
+
+	defaultDroppedTopic = "Dropped"
+)
+
+// DropModes is the list of the supported drop mode
+var DropModes = []string{DropByBlock, DropByTime}
+
+// DropConfig is the config to drop the pending transactions which never confirm
+type DropConfig struct {
+	Mode    string        // block or time
+	Blocks  uint64        `json:",omitempty"` // for block mode
+	Timeout time.Duration `json:",omitempty"` // for time mode
+	Topic   string        // the dedicated topic for dropped transactions
+}
+
+func (d *DropConfig) check() error {
+	switch d.Mode {
+	case DropByBlock:
+	case DropByTime:
+		if d.Timeout <= 0 {
+			return fmt.Errorf("drop timeout must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("drop mode only %s or %s", DropByBlock, DropByTime)
+	}
+	if d.Topic == "" {
+		d.Topic = defaultDroppedTopic
+	}
+
+	return nil
+}
+
+// expired checks whether the transaction should be dropped at the head block
+func (d *DropConfig) expired(txAge *TxAge, head uint64, now time.Time) bool {
+	if d.Mode == DropByTime {
+		return now.Sub(txAge.since) > d.Timeout
+	}
+
+	return head > txAge.queued && head-txAge.queued > d.Blocks
+}
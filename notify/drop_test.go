@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestDropExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		drop    DropConfig
+		queued  uint64
+		since   time.Duration // ago
+		head    uint64
+		expired bool
+	}{
+		{DropConfig{Mode: DropByBlock, Blocks: 13}, 100, 0, 100, false},
+		{DropConfig{Mode: DropByBlock, Blocks: 13}, 100, 0, 113, false},
+		{DropConfig{Mode: DropByBlock, Blocks: 13}, 100, 0, 114, true},
+		{DropConfig{Mode: DropByBlock, Blocks: 13}, 100, time.Hour, 99, false}, // the head behind the queued block
+		{DropConfig{Mode: DropByBlock}, 100, 0, 101, true},
+		{DropConfig{Mode: DropByTime, Timeout: time.Minute}, 100, 30 * time.Second, 1000, false},
+		{DropConfig{Mode: DropByTime, Timeout: time.Minute}, 100, 2 * time.Minute, 100, true},
+	}
+	for i, test := range tests {
+		txAge := &TxAge{queued: test.queued, since: now.Add(-test.since)}
+		if expired := test.drop.expired(txAge, test.head, now); expired != test.expired {
+			t.Errorf("%d: expired mismatch: have %v, want %v", i, expired, test.expired)
+		}
+	}
+}
+
+func TestDropConfigCheck(t *testing.T) {
+	tests := []struct {
+		drop DropConfig
+		ok   bool
+	}{
+		{DropConfig{Mode: DropByBlock}, true},
+		{DropConfig{Mode: DropByTime, Timeout: time.Minute}, true},
+		{DropConfig{Mode: DropByTime}, false},
+		{DropConfig{Mode: "never"}, false},
+	}
+	for _, test := range tests {
+		err := test.drop.check()
+		if (err == nil) != test.ok {
+			t.Errorf("check %+v: %v", test.drop, err)
+		}
+		if err == nil && test.drop.Topic != defaultDroppedTopic {
+			t.Errorf("default topic mismatch: %s", test.drop.Topic)
+		}
+	}
+}
+
+func TestPublishDropped(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		want     []string
+	}{
+		{"", []string{"newchain/97549e368acafdcae786bb93d98379f1d1561a29/dropped", defaultDroppedTopic}},
+		{"{prefix}{type}/{address}/{confirmations}", []string{"newchain/dropped/97549e368acafdcae786bb93d98379f1d1561a29/dropped", defaultDroppedTopic}},
+	} {
+		n := &TransaferNotify{
+			Notify: Notify{p: &NotifyConfig{PrefixTopic: "newchain/", TopicTemplate: test.template}, Logger: log.New()},
+			block:  3,
+			drop:   &DropConfig{Mode: DropByBlock, Topic: defaultDroppedTopic},
+		}
+		if err := n.parseTopicTemplates(); err != nil {
+			t.Fatal(err)
+		}
+		pub := new(recordPublisher)
+		n.publishDropped(pub, testTransferTx(common.HexToHash("0x01")))
+		topics := pub.topics()
+		if len(topics) != len(test.want) {
+			t.Fatalf("dropped topics mismatch: have %v, want %v", topics, test.want)
+		}
+		for i := range topics {
+			// never on the confirmation topic
+			if topics[i] != test.want[i] {
+				t.Errorf("dropped topic mismatch: have %s, want %s", topics[i], test.want[i])
+			}
+		}
+	}
+
+	// the contract creation is only dropped to the dropped topic
+	n := &TransaferNotify{Notify: Notify{p: &NotifyConfig{PrefixTopic: "newchain/"}, Logger: log.New()}, drop: &DropConfig{Topic: defaultDroppedTopic}}
+	pub := new(recordPublisher)
+	tx := testTransferTx(common.HexToHash("0x01"))
+	tx.To = nil
+	n.publishDropped(pub, tx)
+	if topics := pub.topics(); len(topics) != 1 || topics[0] != defaultDroppedTopic {
+		t.Errorf("dropped topics mismatch: %v", topics)
+	}
+}
@@ -9,7 +9,7 @@ type errorLogger struct {
 }
 
 func (e errorLogger) Println(v ...interface{}) {
-	e.Errorln(v)
+	e.Errorln(v...)
 }
 
 func (e errorLogger) Printf(format string, v ...interface{}) {
@@ -21,7 +21,7 @@ type warnLogger struct {
 }
 
 func (e warnLogger) Println(v ...interface{}) {
-	e.Warnln(v)
+	e.Warnln(v...)
 }
 
 func (e warnLogger) Printf(format string, v ...interface{}) {
@@ -33,7 +33,7 @@ type debugLogger struct {
 }
 
 func (e debugLogger) Println(v ...interface{}) {
-	e.Debugln(v)
+	e.Debugln(v...)
 }
 
 func (e debugLogger) Printf(format string, v ...interface{}) {
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"github.com/newtonproject/newchain-notify/notify/notifypb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCConfig is the config of the gRPC server
+type GRPCConfig struct {
+	Addr     string
+	Tokens   []string `json:"-"` // the bearer tokens accepted, empty for no authentication
+	CertFile string   // the server certificate, served in plaintext if empty
+	KeyFile  string
+	CAFile   string // the CA bundle to require and verify the client certificates
+}
+
+// grpcFilter returns the hub filter of the request
+func grpcFilter(r *notifypb.SubscribeRequest) (SubscribeFilter, error) {
+	filter := SubscribeFilter{
+		Confirmations:  r.Confirmations,
+		IncludePending: r.IncludePending,
+	}
+	addresses, err := parseAddresses(r.Addresses)
+	if err != nil {
+		return filter, err
+	}
+	filter.Addresses = addresses
+	if r.Cursor != nil {
+		filter.After = &Cursor{Block: r.Cursor.Block, Position: r.Cursor.Position}
+	} else if r.FromBlock > 0 {
+		filter.After = &Cursor{Block: r.FromBlock - 1, Position: ^uint64(0)}
+	}
+
+	return filter, nil
+}
+
+// grpcEvent returns the protobuf message of the event
+func grpcEvent(e *Event) *notifypb.Event {
+	return &notifypb.Event{
+		Cursor:        &notifypb.Cursor{Block: e.Cursor.Block, Position: e.Cursor.Position},
+		Type:          e.Type,
+		Address:       e.Address,
+		Confirmations: e.Confirmations,
+		Topic:         e.Topic,
+		Tx:            e.Tx,
+	}
+}
+
+type grpcServer struct {
+	notifypb.UnimplementedNotifyServer
+
+	hub *Hub
+}
+
+// Subscribe streams the events of the hub selected by the request till the client
+// cancels, or the subscription ends.
+func (s *grpcServer) Subscribe(req *notifypb.SubscribeRequest, stream notifypb.Notify_SubscribeServer) error {
+	filter, err := grpcFilter(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub, err := s.hub.Subscribe(filter)
+	if err != nil {
+		return hubStatus(err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return hubStatus(sub.Err())
+			}
+			if err := stream.Send(grpcEvent(e)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// hubStatus returns the gRPC status of the hub error
+func hubStatus(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case ErrCursorExpired:
+		return status.Error(codes.OutOfRange, err.Error())
+	case ErrSlowSubscriber:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case ErrHubClosed:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// grpcAuth returns the interceptor which accepts the streams with the metadata
+// authorization: Bearer <token> of any of the tokens
+func grpcAuth(tokens []string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		for _, auth := range md.Get("authorization") {
+			if !strings.HasPrefix(auth, "Bearer ") {
+				continue
+			}
+			for _, token := range tokens {
+				if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+					return handler(srv, ss)
+				}
+			}
+		}
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+}
+
+// NewGRPCServer returns the gRPC server with the Notify service on the hub
+func NewGRPCServer(hub *Hub, tokens []string, opts ...grpc.ServerOption) *grpc.Server {
+	if len(tokens) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(grpcAuth(tokens)))
+	}
+	s := grpc.NewServer(opts...)
+	notifypb.RegisterNotifyServer(s, &grpcServer{hub: hub})
+
+	return s
+}
+
+// ServeGRPC listens on the address of the config, and serves the gRPC server in background,
+// over TLS if the certificate is set
+func ServeGRPC(c *GRPCConfig, hub *Hub, logger *log.Logger) (*grpc.Server, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if len(c.Tokens) > 0 {
+		logger.Warnln("gRPC tokens are sent in plaintext without CertFile and KeyFile")
+	}
+
+	l, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := NewGRPCServer(hub, c.Tokens, opts...)
+	go func() {
+		if err := s.Serve(l); err != nil {
+			logger.Errorln(err)
+		}
+	}()
+	logger.Infof("gRPC server listening on %s", l.Addr())
+
+	return s, nil
+}
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/address"
+	"github.com/newtonproject/newchain-notify/notify/notifypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialBufconn dials the gRPC server listening on the bufconn
+func dialBufconn(t *testing.T, l *bufconn.Listener, opts ...grpc.DialOption) *grpc.ClientConn {
+	opts = append(opts, grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return l.Dial()
+	}))
+	cc, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc
+}
+
+func TestGRPCSubscribe(t *testing.T) {
+	hub := NewHub("newchain/", 0)
+	topic := "newchain/" + hubTo[2:] + "/4"
+	hubPublish(t, hub, topic, hubPayload(common.BytesToHash([]byte{1}).Hex(), 1))
+
+	l := bufconn.Listen(1 << 20)
+	s := NewGRPCServer(hub, []string{"secret"})
+	go s.Serve(l)
+	defer s.Stop()
+
+	cc := dialBufconn(t, l, grpc.WithInsecure())
+	defer cc.Close()
+	client := notifypb.NewNotifyClient(cc)
+
+	req := &notifypb.SubscribeRequest{Addresses: []string{address.ToNEW(common.HexToAddress(hubFrom), 1012)}, Confirmations: 4, FromBlock: 1}
+	stream, err := client.Subscribe(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("error mismatch: have %v, want %v", err, codes.Unauthenticated)
+	}
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret"))
+	defer cancel()
+	stream, err = client.Subscribe(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Cursor.Block != 1 || e.Cursor.Position != 0 || e.Type != EventConfirmed || e.Topic != topic {
+		t.Errorf("replay mismatch: %+v", e)
+	}
+
+	hubPublish(t, hub, topic, hubPayload(common.BytesToHash([]byte{2}).Hex(), 2))
+	if e, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Cursor.Block != 2 || e.Cursor.Position != 0 {
+		t.Errorf("cursor mismatch: have %v, want %v", e.Cursor, Cursor{2, 0})
+	}
+
+	// resume after the cursor of the first event
+	stream, err = client.Subscribe(ctx, &notifypb.SubscribeRequest{Cursor: &notifypb.Cursor{Block: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Cursor.Block != 2 || string(e.Tx) != hubPayload(common.BytesToHash([]byte{2}).Hex(), 2) {
+		t.Errorf("resume mismatch: %+v", e)
+	}
+
+	stream, err = client.Subscribe(ctx, &notifypb.SubscribeRequest{Addresses: []string{"0xinvalid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("error mismatch: have %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPCTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+
+	if config, err := (&GRPCConfig{}).TLSConfig(); config != nil || err != nil {
+		t.Errorf("TLS config mismatch: have %v %v, want nil", config, err)
+	}
+	if _, err := (&GRPCConfig{CAFile: certFile}).TLSConfig(); err == nil {
+		t.Errorf("want error without CertFile and KeyFile")
+	}
+	config, err := (&GRPCConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile}).TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := NewHub("newchain/", 0)
+	topic := "newchain/" + hubTo[2:] + "/4"
+	hubPublish(t, hub, topic, hubPayload(common.BytesToHash([]byte{1}).Hex(), 1))
+
+	l := bufconn.Listen(1 << 20)
+	s := NewGRPCServer(hub, []string{"secret"}, grpc.Creds(credentials.NewTLS(config)))
+	go s.Serve(l)
+	defer s.Stop()
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret"))
+	defer cancel()
+	req := &notifypb.SubscribeRequest{FromBlock: 1}
+
+	// the test certificate has no SAN, so only the client certificate is verified
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, clientCert := range [][]tls.Certificate{nil, {cert}} {
+		cc := dialBufconn(t, l, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates:       clientCert,
+			InsecureSkipVerify: true,
+		})))
+		stream, err := notifypb.NewNotifyClient(cc).Subscribe(ctx, req)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		cc.Close()
+		if clientCert == nil && err == nil {
+			t.Errorf("subscribed without the client certificate")
+		}
+		if clientCert != nil && err != nil {
+			t.Errorf("subscribe with the client certificate: %v", err)
+		}
+	}
+}
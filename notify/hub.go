@@ -0,0 +1,378 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/newtonproject/newchain-notify/address"
+)
+
+const (
+	// EventPending is the event of the pending transaction
+	EventPending = "pending"
+	// EventConfirmed is the event of the confirmed transaction
+	EventConfirmed = "confirmed"
+	// EventInternal is the event of the internal transaction traced by the monitor
+	EventInternal = "internal"
+	// EventToken is the event of the confirmed ERC20 token transfer
+	EventToken = "token"
+
+	defaultHubHistory  = 10000
+	subscriptionBuffer = 256
+)
+
+var (
+	// ErrCursorExpired is returned when the events after the cursor are no longer in the history
+	ErrCursorExpired = errors.New("cursor expired")
+	// ErrSlowSubscriber closes the subscription which does not receive the events in time
+	ErrSlowSubscriber = errors.New("subscriber too slow")
+	// ErrHubClosed closes the subscriptions when the hub is closed
+	ErrHubClosed = errors.New("hub closed")
+)
+
+// the ERC20 transfer(address,uint256) and transferFrom(address,address,uint256)
+var (
+	tokenTransfer     = []byte{0xa9, 0x05, 0x9c, 0xbb}
+	tokenTransferFrom = []byte{0x23, 0xb8, 0x72, 0xdd}
+)
+
+// Cursor is the position of the event, by the block number and the position of the
+// event among the events of the block. A pending event is positioned after the events
+// of the latest block seen. The position is counted by the hub as the events arrive,
+// not by the transaction or log index, so the cursor is local to the process: after a
+// restart the history is empty, and the client should replay from the block instead.
+type Cursor struct {
+	Block    uint64
+	Position uint64
+}
+
+// ParseCursor parses the cursor in the form of <block>-<position>
+func ParseCursor(s string) (Cursor, error) {
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	block, err := strconv.ParseUint(s[:i], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	position, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+
+	return Cursor{Block: block, Position: position}, nil
+}
+
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d-%d", c.Block, c.Position)
+}
+
+// Less reports whether the cursor is before the other
+func (c Cursor) Less(other Cursor) bool {
+	return c.Block < other.Block || (c.Block == other.Block && c.Position < other.Position)
+}
+
+func (c Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Cursor) UnmarshalText(text []byte) error {
+	cursor, err := ParseCursor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = cursor
+	return nil
+}
+
+// Event is the notification of the address delivered by the hub
+type Event struct {
+	Cursor        Cursor          `json:"cursor"`
+	Type          string          `json:"type"`    // pending, confirmed, internal, token, unconfirmed or dropped
+	Address       string          `json:"address"` // the address of the topic
+	Confirmations uint64          `json:"confirmations"`
+	Topic         string          `json:"topic"`
+	Tx            json.RawMessage `json:"tx"` // the TransferTx as published
+
+	related []common.Address // the addresses the event is matched by
+}
+
+// SubscribeFilter selects the events of a subscription
+type SubscribeFilter struct {
+	// Addresses are the senders, receivers or token parties to match, empty for all
+	Addresses []common.Address
+	// Confirmations is the min confirmations of the confirmed events, 0 for all
+	Confirmations uint64
+	// IncludePending includes the pending events
+	IncludePending bool
+	// After replays the events after the cursor in the history if set
+	After *Cursor
+}
+
+// parseAddresses parses the hex or NEW addresses of the filter
+func parseAddresses(ss []string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, s := range ss {
+		a, err := address.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, nil
+}
+
+func (f *SubscribeFilter) match(e *Event) bool {
+	if e.Type == EventPending {
+		if !f.IncludePending {
+			return false
+		}
+	} else if e.Type != EventDropped && e.Type != EventUnconfirmed && e.Confirmations < f.Confirmations {
+		return false
+	}
+	if len(f.Addresses) == 0 {
+		return true
+	}
+	for _, address := range f.Addresses {
+		for _, related := range e.related {
+			if address == related {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Subscription is the events of the hub selected by the filter
+type Subscription struct {
+	hub    *Hub
+	filter SubscribeFilter
+	ch     chan *Event
+	err    error
+	once   sync.Once
+}
+
+// Events returns the channel of the events, which is closed once the subscription ends
+func (s *Subscription) Events() <-chan *Event {
+	return s.ch
+}
+
+// Err returns the reason the subscription ended, nil if unsubscribed
+func (s *Subscription) Err() error {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+	return s.err
+}
+
+// Unsubscribe ends the subscription
+func (s *Subscription) Unsubscribe() {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+	s.hub.remove(s, nil)
+}
+
+// Hub keeps the recent events of the address topics published to it, and delivers
+// them to the subscriptions, which can be resumed by the cursor within the history.
+// It is added as a sink of the notify, to feed the streaming APIs.
+type Hub struct {
+	prefix string
+	size   int
+
+	lock     sync.Mutex
+	history  []*Event
+	evicted  *Cursor // the cursor of the latest event evicted from the history
+	last     Cursor
+	lastHash common.Hash
+	subs     map[*Subscription]struct{}
+	closed   bool
+}
+
+// NewHub creates the hub which keeps the last history events of the address topics
+// under the prefix topic
+func NewHub(prefix string, history int) *Hub {
+	if history <= 0 {
+		history = defaultHubHistory
+	}
+	return &Hub{
+		prefix: prefix,
+		size:   history,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish adds the notification of the address topic as the event, including the
+// dropped and unconfirmed topics of the address, other topics such as DroppedTopic are ignored, as
+// the notification is also published to the address topic.
+func (h *Hub) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	address, level := notificationAddress(h.prefix, topic, payload)
+	if level == "" && topic != h.prefix+"ContractCreate" {
+		return nil
+	}
+	var confirmations uint64
+	if level != "" && level != EventDropped && level != EventUnconfirmed {
+		var err error
+		if confirmations, err = strconv.ParseUint(level, 10, 64); err != nil {
+			return nil
+		}
+	}
+
+	var tx struct {
+		From        common.Address  `json:"from"`
+		To          *common.Address `json:"to"`
+		Hash        common.Hash     `json:"hash"`
+		Data        hexutil.Bytes   `json:"data"`
+		BlockNumber *hexutil.Big    `json:"blockNumber"`
+		Event       string          `json:"event"`
+	}
+	if err := json.Unmarshal(payload, &tx); err != nil {
+		// the hub only feeds the streaming APIs, so never fails the delivery
+		return nil
+	}
+
+	e := &Event{
+		Type:          EventConfirmed,
+		Address:       address,
+		Confirmations: confirmations,
+		Topic:         topic,
+		Tx:            append(json.RawMessage(nil), payload...),
+		related:       []common.Address{tx.From},
+	}
+	if tx.To != nil {
+		e.related = append(e.related, *tx.To)
+	}
+	parties, token := tokenParties(tx.Data)
+	e.related = append(e.related, parties...)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return nil
+	}
+
+	block := h.last.Block
+	if tx.BlockNumber != nil && tx.BlockNumber.ToInt().Uint64() > block {
+		block = tx.BlockNumber.ToInt().Uint64()
+	}
+	switch {
+	case tx.Event != "":
+		e.Type = tx.Event
+	case tx.BlockNumber == nil || confirmations == 0 && level != "":
+		e.Type = EventPending
+	case tx.Hash == h.lastHash && block == h.last.Block:
+		// the monitor publishes the internal transactions after the top call of the transaction
+		e.Type = EventInternal
+	case token:
+		e.Type = EventToken
+	}
+	if e.Type == EventConfirmed || e.Type == EventToken {
+		h.lastHash = tx.Hash
+	}
+
+	if block > h.last.Block || len(h.history) == 0 && h.evicted == nil {
+		e.Cursor = Cursor{Block: block}
+	} else {
+		e.Cursor = Cursor{Block: h.last.Block, Position: h.last.Position + 1}
+	}
+	h.last = e.Cursor
+
+	h.history = append(h.history, e)
+	if len(h.history) > h.size {
+		evicted := h.history[0].Cursor
+		h.evicted = &evicted
+		h.history[0] = nil
+		h.history = h.history[1:]
+	}
+
+	for s := range h.subs {
+		if !s.filter.match(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			h.remove(s, ErrSlowSubscriber)
+		}
+	}
+
+	return nil
+}
+
+// tokenParties returns the parties of the ERC20 transfer in the data besides the
+// sender of the transaction
+func tokenParties(data []byte) ([]common.Address, bool) {
+	switch {
+	case len(data) >= 4+32*2 && bytes.Equal(data[:4], tokenTransfer):
+		return []common.Address{common.BytesToAddress(data[4+12 : 4+32])}, true
+	case len(data) >= 4+32*3 && bytes.Equal(data[:4], tokenTransferFrom):
+		return []common.Address{
+			common.BytesToAddress(data[4+12 : 4+32]),
+			common.BytesToAddress(data[4+32+12 : 4+32*2]),
+		}, true
+	}
+	return nil, false
+}
+
+// Subscribe subscribes the events by the filter. If the After cursor of the filter
+// is set, the events after it in the history are delivered first, or ErrCursorExpired
+// is returned if some of them are evicted.
+func (h *Hub) Subscribe(filter SubscribeFilter) (*Subscription, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	var replay []*Event
+	if filter.After != nil {
+		if h.evicted != nil && filter.After.Less(*h.evicted) {
+			return nil, ErrCursorExpired
+		}
+		for _, e := range h.history {
+			if filter.After.Less(e.Cursor) && filter.match(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	s := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan *Event, len(replay)+subscriptionBuffer),
+	}
+	for _, e := range replay {
+		s.ch <- e
+	}
+	h.subs[s] = struct{}{}
+
+	return s, nil
+}
+
+// remove ends the subscription with the error, the lock must be held
+func (h *Hub) remove(s *Subscription, err error) {
+	s.once.Do(func() {
+		delete(h.subs, s)
+		s.err = err
+		close(s.ch)
+	})
+}
+
+// Close ends all the subscriptions with ErrHubClosed
+func (h *Hub) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s, ErrHubClosed)
+	}
+	return nil
+}
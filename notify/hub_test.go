@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	hubFrom = "0x0000000000000000000000000000000000000001"
+	hubTo   = "0x97549e368acafdcae786bb93d98379f1d1561a29"
+)
+
+func hubPublish(t *testing.T, h *Hub, topic, payload string) {
+	t.Helper()
+	if err := h.Publish(context.Background(), topic, []byte(payload), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hubPayload(hash string, block int) string {
+	if block < 0 {
+		return fmt.Sprintf(`{"from":"%s","to":"%s","hash":"%s","data":"0x"}`, hubFrom, hubTo, hash)
+	}
+	return fmt.Sprintf(`{"from":"%s","to":"%s","hash":"%s","data":"0x","blockNumber":"%#x"}`, hubFrom, hubTo, hash, block)
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub("newchain/", 4)
+	topic := "newchain/" + hubTo[2:]
+	hash1 := common.BytesToHash([]byte{1}).Hex()
+	hash2 := common.BytesToHash([]byte{2}).Hex()
+	token := fmt.Sprintf(`{"from":"%s","to":"%s","hash":"%s","blockNumber":"0x2","data":"0xa9059cbb%064x%064x"}`,
+		hubFrom, hubTo, hash2, common.HexToAddress("0x02").Big(), 1)
+
+	all, err := h.Subscribe(SubscribeFilter{IncludePending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, err := h.Subscribe(SubscribeFilter{Addresses: []common.Address{common.HexToAddress("0x02")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hubPublish(t, h, "RawTransaction", hubPayload(hash1, -1)) // ignored
+	hubPublish(t, h, topic+"/0", hubPayload(hash1, -1))
+	hubPublish(t, h, topic+"/4", hubPayload(hash1, 1))
+	hubPublish(t, h, topic+"/4", hubPayload(hash1, 1))
+	hubPublish(t, h, topic+"/4", token)
+
+	want := []struct {
+		cursor Cursor
+		typ    string
+	}{
+		{Cursor{0, 0}, EventPending},
+		{Cursor{1, 0}, EventConfirmed},
+		{Cursor{1, 1}, EventInternal},
+		{Cursor{2, 0}, EventToken},
+	}
+	for _, w := range want {
+		e := <-all.Events()
+		if e.Cursor != w.cursor || e.Type != w.typ {
+			t.Errorf("event mismatch: have %v %s, want %v %s", e.Cursor, e.Type, w.cursor, w.typ)
+		}
+	}
+	if e := <-token2.Events(); e.Type != EventToken || e.Address != common.HexToAddress(hubTo).Hex() {
+		t.Errorf("token event mismatch: have %s %s", e.Type, e.Address)
+	}
+
+	// resume after the cursor without the pending events
+	sub, err := h.Subscribe(SubscribeFilter{Confirmations: 4, After: &Cursor{1, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := <-sub.Events(); e.Cursor != (Cursor{1, 1}) {
+		t.Errorf("replay mismatch: have %v, want %v", e.Cursor, Cursor{1, 1})
+	}
+	if _, err := h.Subscribe(SubscribeFilter{Confirmations: 5, After: &Cursor{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// evicts the pending event
+	hubPublish(t, h, topic+"/4", hubPayload(hash2, 3))
+	if _, err := h.Subscribe(SubscribeFilter{After: &Cursor{0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	hubPublish(t, h, topic+"/4", hubPayload(hash1, 4))
+	if _, err := h.Subscribe(SubscribeFilter{After: &Cursor{0, 0}}); err != ErrCursorExpired {
+		t.Errorf("subscribe error mismatch: have %v, want %v", err, ErrCursorExpired)
+	}
+
+	h.Close()
+	for range all.Events() {
+	}
+	if err := all.Err(); err != ErrHubClosed {
+		t.Errorf("subscription error mismatch: have %v, want %v", err, ErrHubClosed)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	c, err := ParseCursor("12-3")
+	if err != nil || c != (Cursor{12, 3}) || c.String() != "12-3" {
+		t.Errorf("cursor mismatch: have %v %v", c, err)
+	}
+	for _, s := range []string{"", "12", "a-3", "12-"} {
+		if _, err := ParseCursor(s); err == nil {
+			t.Errorf("parse %q: want error", s)
+		}
+	}
+}
+
+func TestHubDropped(t *testing.T) {
+	h := NewHub("newchain/", 4)
+	sub, err := h.Subscribe(SubscribeFilter{Confirmations: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := common.BytesToHash([]byte{1}).Hex()
+	payload := fmt.Sprintf(`{"from":"%s","to":"%s","hash":"%s","data":"0x","event":"dropped"}`, hubFrom, hubTo, hash)
+	hubPublish(t, h, "Dropped", payload) // ignored
+	hubPublish(t, h, "newchain/"+hubTo[2:]+"/dropped", payload)
+	if e := <-sub.Events(); e.Type != EventDropped || e.Confirmations != 0 {
+		t.Errorf("dropped event mismatch: have %s %d", e.Type, e.Confirmations)
+	}
+
+	payload = fmt.Sprintf(`{"from":"%s","to":"%s","hash":"%s","data":"0x","blockNumber":"0x8","event":"unconfirmed"}`, hubFrom, hubTo, hash)
+	hubPublish(t, h, "newchain/"+hubTo[2:]+"/unconfirmed", payload)
+	if e := <-sub.Events(); e.Type != EventUnconfirmed || e.Confirmations != 0 {
+		t.Errorf("unconfirmed event mismatch: have %s %d", e.Type, e.Confirmations)
+	}
+}
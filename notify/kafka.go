@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+const defaultKafkaVersion = "2.0.0"
+
+// KafkaConfig is the config of the Kafka publisher
+type KafkaConfig struct {
+	Brokers     []string
+	ClientID    string
+	Version     string // the Kafka version, at least 0.11.0 for the idempotent producer
+	PrefixTopic string // the PrefixTopic of the publish config, to map the address topics
+}
+
+// kafkaPublisher publishes to Kafka by the idempotent sync producer, keyed by the
+// address so that the notifications of an address keep their order in a partition.
+//
+// The topics are mapped as follows, with the characters not allowed by Kafka
+// replaced by dots:
+//   - PrefixTopic/<address>/<confirmations> to PrefixTopic.<confirmations>, keyed by the address
+//   - PrefixTopic/ContractCreate to PrefixTopic.ContractCreate, keyed by the sender
+//   - the others such as Transfer to themselves, keyed by the receiver or the sender
+type kafkaPublisher struct {
+	producer sarama.SyncProducer
+	prefix   string
+}
+
+// NewKafkaPublisher connects to the Kafka brokers
+func NewKafkaPublisher(c *KafkaConfig) (Publisher, error) {
+	if c == nil || len(c.Brokers) == 0 {
+		return nil, errors.New("kafka brokers can not be empty")
+	}
+	config, err := newKafkaConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducer(c.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaPublisher{producer: producer, prefix: c.PrefixTopic}, nil
+}
+
+// newKafkaConfig returns the producer config, which is idempotent and waits for
+// all the in-sync replicas to acknowledge
+func newKafkaConfig(c *KafkaConfig) (*sarama.Config, error) {
+	if c.Version == "" {
+		c.Version = defaultKafkaVersion
+	}
+	version, err := sarama.ParseKafkaVersion(c.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Version = version
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Net.MaxOpenRequests = 1
+
+	return config, config.Validate()
+}
+
+// Publish returns once the message is acknowledged by all the in-sync replicas
+func (p *kafkaPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	kafkaTopic, key := p.mapTopic(topic, payload)
+	msg := &sarama.ProducerMessage{
+		Topic: kafkaTopic,
+		Value: sarama.ByteEncoder(payload),
+	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := p.producer.SendMessage(msg)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.producer.Close()
+}
+
+const kafkaTopicMaxBytes = 249
+
+var kafkaInvalidTopic = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// mapTopic maps the topic to the Kafka topic and the message key
+func (p *kafkaPublisher) mapTopic(topic string, payload []byte) (string, string) {
+	address, level := notificationAddress(p.prefix, topic, payload)
+	if level != "" {
+		return kafkaTopic(p.prefix + level), address
+	}
+
+	return kafkaTopic(topic), address
+}
+
+// kafkaTopic replaces the characters not allowed in the Kafka topic by dots
+func kafkaTopic(topic string) string {
+	topic = strings.Trim(kafkaInvalidTopic.ReplaceAllString(topic, "."), ".")
+	if len(topic) > kafkaTopicMaxBytes {
+		topic = topic[:kafkaTopicMaxBytes]
+	}
+	return topic
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func TestKafkaMapTopic(t *testing.T) {
+	p := &kafkaPublisher{prefix: "newchain/"}
+	to := "0x97549E368AcaFdCAE786BB93D98379f1D1561a29"
+	payload := []byte(`{"from":"0x0000000000000000000000000000000000000001","to":"` + to + `"}`)
+	create := []byte(`{"from":"0x0000000000000000000000000000000000000001","to":null}`)
+
+	tests := []struct {
+		topic   string
+		payload []byte
+		kafka   string
+		key     string
+	}{
+		{"newchain/97549e368acafdcae786bb93d98379f1d1561a29/4", payload, "newchain.4", to},
+		{"newchain/ContractCreate", create, "newchain.ContractCreate", "0x0000000000000000000000000000000000000001"},
+		{"Transfer4", payload, "Transfer4", to},
+	}
+	for _, tt := range tests {
+		kafka, key := p.mapTopic(tt.topic, tt.payload)
+		if kafka != tt.kafka || key != tt.key {
+			t.Errorf("map %s: have %s %s, want %s %s", tt.topic, kafka, key, tt.kafka, tt.key)
+		}
+	}
+}
+
+func TestKafkaPublisher(t *testing.T) {
+	config, err := newKafkaConfig(&KafkaConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Producer.Idempotent || config.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("producer is not idempotent with all acks")
+	}
+
+	producer := mocks.NewSyncProducer(t, config)
+	payload := []byte(`{"to":"0x97549e368acafdcae786bb93d98379f1d1561a29"}`)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		var tx map[string]interface{}
+		return json.Unmarshal(val, &tx)
+	})
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+
+	p := &kafkaPublisher{producer: producer, prefix: "newchain/"}
+	if err := p.Publish(context.Background(), "newchain/97549e368acafdcae786bb93d98379f1d1561a29/4", payload, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "Transfer4", payload, nil); !errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		t.Errorf("publish error mismatch: have %v, want %v", err, sarama.ErrNotEnoughReplicas)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
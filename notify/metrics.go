@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const metricsPath = "/debug/vars"
+
+// subscriberMetrics is the connection state of the subscriber, published by expvar as
+// "subscriber" with the connected gauge and the counters of the connection events
+var (
+	subscriberMetrics   = expvar.NewMap("subscriber")
+	subscriberConnected = new(expvar.Int)
+)
+
+const (
+	metricConnects        = "connects"        // the successful connects, including the reconnects
+	metricConnectErrors   = "connectErrors"   // the failed connect attempts
+	metricConnectionsLost = "connectionsLost" // the connections lost
+	metricSubscribeErrors = "subscribeErrors" // the failed subscribes
+	metricMessages        = "messages"        // the messages received
+)
+
+func init() {
+	subscriberMetrics.Set("connected", subscriberConnected)
+}
+
+// setSubscriberConnected records the connection state of the subscriber
+func setSubscriberConnected(connected bool) {
+	if connected {
+		subscriberConnected.Set(1)
+		subscriberMetrics.Add(metricConnects, 1)
+	} else {
+		subscriberConnected.Set(0)
+		subscriberMetrics.Add(metricConnectionsLost, 1)
+	}
+}
+
+// MetricsConfig is the config of the metrics server
+type MetricsConfig struct {
+	Addr string
+}
+
+// ServeMetrics listens on the address of the config, and serves the expvar metrics
+// as JSON on /debug/vars in background
+func ServeMetrics(c *MetricsConfig, logger *log.Logger) (*http.Server, error) {
+	l, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, expvar.Handler())
+	s := &http.Server{Addr: l.Addr().String(), Handler: mux}
+	go func() {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorln(err)
+		}
+	}()
+	logger.Infof("Metrics server listening on %s%s", l.Addr(), metricsPath)
+
+	return s, nil
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRetryConnect(t *testing.T) {
+	n := &Notify{s: &NotifyConfig{ConnectRetries: 1}, Logger: log.New(), quit: make(chan struct{}, 1)}
+	connectErrors := func() int64 {
+		if v, ok := subscriberMetrics.Get(metricConnectErrors).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := connectErrors()
+
+	attempts := 0
+	connect := func() error {
+		attempts++
+		return errors.New("connection refused")
+	}
+	if err := n.retryConnect("test", connect); err == nil || err == errQuit {
+		t.Errorf("retry error mismatch: have %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts mismatch: have %d, want %d", attempts, 2)
+	}
+	if errs := connectErrors() - before; errs != 2 {
+		t.Errorf("connect errors mismatch: have %d, want %d", errs, 2)
+	}
+
+	// unlimited retries till quit
+	n.s.ConnectRetries = 0
+	n.quit <- struct{}{}
+	if err := n.retryConnect("test", connect); err != errQuit {
+		t.Errorf("retry error mismatch: have %v, want %v", err, errQuit)
+	}
+
+	attempts = 0
+	if err := n.retryConnect("test", func() error { attempts++; return nil }); err != nil || attempts != 1 {
+		t.Errorf("connect mismatch: have %v after %d attempts", err, attempts)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	s, err := ServeMetrics(&MetricsConfig{Addr: "127.0.0.1:0"}, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	setSubscriberConnected(true)
+	defer setSubscriberConnected(false)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s%s", s.Addr, metricsPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var vars struct {
+		Subscriber map[string]int64 `json:"subscriber"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars.Subscriber["connected"] != 1 || vars.Subscriber[metricConnects] == 0 {
+		t.Errorf("subscriber metrics mismatch: %v", vars.Subscriber)
+	}
+}
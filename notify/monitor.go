@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -31,17 +32,23 @@ func NewMonitorNotify(p *NotifyConfig, rpcURL string, blockDelay int64, enableTr
 	if p == nil {
 		return nil, errors.New("publish config can not be nil")
 	}
-	return &MonitorNotify{
+	n := &MonitorNotify{
 		Notify: Notify{
 			p:      p,
 			Logger: logger,
 			quit:   make(chan struct{}, 1),
+			status: newServiceStatus(ServiceMonitor, blockDelay),
 		},
 		blockDelay:   blockDelay,
 		rpcURL:       rpcURL,
 		enableTracer: enableTracer,
 		traceConfig:  traceConfig,
-	}, nil
+	}
+	if err := n.parseTopicTemplates(); err != nil {
+		return nil, err
+	}
+
+	return n, nil
 }
 
 // MarshalJSON encodes to json format.
@@ -81,13 +88,13 @@ func (n *MonitorNotify) Run() error {
 }
 
 func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
-	pClient, err := n.getPublishClient()
+	pub, err := n.getPublisher()
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
-	if pClient == nil {
-		log.Errorln(errors.New("publish client nil"))
+	if pub == nil {
+		log.Errorln(errors.New("publisher nil"))
 		return
 	}
 
@@ -98,6 +105,7 @@ func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
 		return
 	}
 	client := ethclient.NewClient(c)
+	n.setStatusClient(client)
 
 	blockDelay := n.blockDelay
 	ctx := context.Background()
@@ -161,6 +169,16 @@ func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
 	log.Infof("Monitor from block number	%d", currentBlockNumber.Uint64())
 
 	getBlocks := func() error {
+		// the blocks after the messages in the outbox are handled once they are all acknowledged
+		if n.outbox != nil && n.outbox.Len() > 0 {
+			if err := n.outbox.Replay(); err != nil {
+				return fmt.Errorf("replay outbox of %d messages: %v", n.outbox.Len(), err)
+			}
+			if err := n.saveBlockHeight(currentBlockNumber); err != nil {
+				return err
+			}
+		}
+
 		latestBlock, err := client.BlockByNumber(ctx, nil)
 		if err != nil {
 			return err
@@ -183,20 +201,10 @@ func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
 				}
 			}
 
-			err = n.saveBlockHeight(currentBlockNumber)
-			if err != nil {
-				return err
-			}
-			currentBlockNumber.Add(currentBlockNumber, big.NewInt(1))
-
 			log.Infof("Handle block %d with txs is %d", block.NumberU64(), block.Transactions().Len())
 
 			txs := block.Transactions()
 			txLen := txs.Len()
-			if txLen == 0 {
-				continue
-			}
-
 			for i := 0; i < txLen; i++ {
 				tx := txs[i]
 
@@ -220,7 +228,9 @@ func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
 								BlockNumber: block.Number(),
 							}
 
-							n.publishToBlockTopic(pClient, &ttx, blockDelay+1)
+							if err := n.publishToBlockTopic(pub, &ttx, blockDelay+1); err != nil {
+								return err
+							}
 						}
 					} else {
 						tracerStatus = false
@@ -245,9 +255,24 @@ func (n *MonitorNotify) monitorBlock(startBlockNumber *big.Int) {
 						BlockNumber: block.Number(),
 					}
 
-					n.publishToBlockTopic(pClient, &ttx, blockDelay+1)
+					if err := n.publishToBlockTopic(pub, &ttx, blockDelay+1); err != nil {
+						return err
+					}
 				}
 			}
+
+			// advance the checkpoint only after all the notifications of the block are delivered,
+			// otherwise the block is handled again
+			currentBlockNumber.Add(currentBlockNumber, big.NewInt(1))
+			if n.outbox != nil && n.outbox.Len() > 0 {
+				// the checkpoint is saved once the outbox is replayed
+				return fmt.Errorf("block %d waits for outbox of %d messages", block.NumberU64(), n.outbox.Len())
+			}
+			err = n.saveBlockHeight(currentBlockNumber)
+			if err != nil {
+				return err
+			}
+			n.setStatusBlockHeight(block.NumberU64())
 		}
 
 		return nil
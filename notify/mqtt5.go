@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	log "github.com/sirupsen/logrus"
+)
+
+// MQTT5 is the MQTTVersion of the config to use the MQTT 5 client
+const MQTT5 = 5
+
+// mqtt5SessionNeverExpire is the session expiry interval of the persistent session
+const mqtt5SessionNeverExpire = 0xFFFFFFFF
+
+// isMQTT5 checks whether the config uses the MQTT 5 client
+func isMQTT5(c *NotifyConfig) bool {
+	return transportOf(c.Server) == transportMQTT && c.MQTTVersion == MQTT5
+}
+
+// mqtt5Config returns the autopaho config by the config, which connects again
+// after the connection is lost, as the paho v3 client does
+func mqtt5Config(c *NotifyConfig, logger *log.Logger) (autopaho.ClientConfig, error) {
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return autopaho.ClientConfig{}, err
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return autopaho.ClientConfig{}, err
+	}
+
+	config := autopaho.ClientConfig{
+		BrokerUrls:        []*url.URL{u},
+		TlsCfg:            tlsConfig,
+		KeepAlive:         30,
+		ConnectRetryDelay: minReconnectBackoff * 5,
+		OnConnectError: func(err error) {
+			logger.Errorln(err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: c.ClientID,
+			OnClientError: func(err error) {
+				logger.Errorln(err)
+			},
+		},
+	}
+	if c.Username != "" {
+		config.SetUsernamePassword(c.Username, []byte(c.Password))
+	}
+
+	return config, nil
+}
+
+// mqtt5Publisher publishes by the MQTT 5 client with the message properties
+type mqtt5Publisher struct {
+	cm *autopaho.ConnectionManager
+}
+
+// NewMQTT5Publisher connects to the MQTT 5 server of the config
+func NewMQTT5Publisher(c *NotifyConfig, logger *log.Logger) (Publisher, error) {
+	return newMQTT5Publisher(c, logger, "", nil, nil)
+}
+
+// newMQTT5Publisher connects with the retained last will if the topic is not empty,
+// and calls onConnect once connected, including connected again
+func newMQTT5Publisher(c *NotifyConfig, logger *log.Logger, willTopic string, willPayload []byte, onConnect func()) (Publisher, error) {
+	config, err := mqtt5Config(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	if willTopic != "" {
+		config.SetWillMessage(willTopic, willPayload, c.QoS, true)
+	}
+	if onConnect != nil {
+		config.OnConnectionUp = func(*autopaho.ConnectionManager, *paho.Connack) {
+			onConnect()
+		}
+	}
+	cm, err := autopaho.NewConnection(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mqtt5Publisher{cm: cm}, nil
+}
+
+// mqtt5Publish returns the publish packet of the message with the properties of the options
+func mqtt5Publish(topic string, payload []byte, opts *PublishOptions) *paho.Publish {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	properties := &paho.PublishProperties{
+		ContentType:     opts.ContentType,
+		CorrelationData: opts.CorrelationData,
+	}
+	for _, property := range opts.UserProperties {
+		properties.User = append(properties.User, paho.UserProperty{Key: property.Key, Value: property.Value})
+	}
+	if opts.MessageExpiry > 0 {
+		expiry := uint32((opts.MessageExpiry + time.Second - 1) / time.Second)
+		properties.MessageExpiry = &expiry
+	}
+
+	return &paho.Publish{
+		Topic:      topic,
+		QoS:        opts.QoS,
+		Retain:     opts.Retained,
+		Payload:    payload,
+		Properties: properties,
+	}
+}
+
+// Publish waits for the connection, and returns once the message is sent for QoS 0,
+// or acknowledged by the broker for QoS 1 and 2.
+func (p *mqtt5Publisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if err := p.cm.AwaitConnection(ctx); err != nil {
+		return err
+	}
+	resp, err := p.cm.Publish(ctx, mqtt5Publish(topic, payload, opts))
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.ReasonCode >= 0x80 {
+		return fmt.Errorf("publish to %s rejected by reason code %#x", topic, resp.ReasonCode)
+	}
+	return nil
+}
+
+func (p *mqtt5Publisher) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return p.cm.Disconnect(ctx)
+}
+
+// runMQTT5Subscribe subscribes the topic by the MQTT 5 client till quit, and
+// subscribes again once connected again.
+func (n *Notify) runMQTT5Subscribe(f messageHandler) error {
+	config, err := mqtt5Config(n.s, n.Logger)
+	if err != nil {
+		n.quit <- struct{}{}
+		return err
+	}
+	if !n.s.CleanSession {
+		// the broker keeps the session, and queues the QoS 1 and 2 messages while disconnected
+		config.SetConnectPacketConfigurator(func(cp *paho.Connect) *paho.Connect {
+			expiry := uint32(mqtt5SessionNeverExpire)
+			cp.CleanStart = false
+			cp.Properties = &paho.ConnectProperties{SessionExpiryInterval: &expiry}
+			return cp
+		})
+	}
+	// the client acknowledges the message once the handler returns, so the failed
+	// message is retried till it is handled
+	config.Router = paho.NewSingleHandlerRouter(func(p *paho.Publish) {
+		n.retryHandle(f, p.Topic, p.Payload)
+	})
+	config.OnConnectError = func(err error) {
+		subscriberMetrics.Add(metricConnectErrors, 1)
+		n.Logger.Errorln(err)
+	}
+	config.OnClientError = func(err error) {
+		setSubscriberConnected(false)
+		n.Logger.Warnf("MQTT 5 connection lost: %v", err)
+	}
+	config.OnServerDisconnect = func(d *paho.Disconnect) {
+		setSubscriberConnected(false)
+		n.Logger.Warnf("MQTT 5 disconnected by the server with reason code %#x", d.ReasonCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config.OnConnectionUp = func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+		setSubscriberConnected(true)
+		for backoff := minReconnectBackoff; ; {
+			_, err := cm.Subscribe(ctx, &paho.Subscribe{
+				Subscriptions: map[string]paho.SubscribeOptions{
+					n.s.Topic: {QoS: n.s.QoS},
+				},
+			})
+			if err == nil {
+				n.Logger.Info("MQTT 5 Connected/Reconnected...")
+				return
+			}
+			subscriberMetrics.Add(metricSubscribeErrors, 1)
+			n.Logger.Errorf("MQTT 5 subscribe %s failed, retry in %v: %v", n.s.Topic, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff *= 2; backoff > n.reconnectInterval() {
+				backoff = n.reconnectInterval()
+			}
+		}
+	}
+
+	cm, err := autopaho.NewConnection(ctx, config)
+	if err != nil {
+		n.quit <- struct{}{}
+		return err
+	}
+
+	<-n.quit
+	disconnect, cancelDisconnect := context.WithTimeout(context.Background(), time.Second)
+	defer cancelDisconnect()
+	cm.Disconnect(disconnect)
+	return nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+func TestMQTT5PublishOptions(t *testing.T) {
+	n := &Notify{p: &NotifyConfig{
+		Server:        "tcp://127.0.0.1:1883",
+		QoS:           1,
+		MQTTVersion:   MQTT5,
+		MessageExpiry: 90 * time.Second,
+		ChainID:       1012,
+	}}
+	if !isMQTT5(n.p) || isMQTT5(&NotifyConfig{Server: "nats://127.0.0.1:4222", MQTTVersion: MQTT5}) {
+		t.Errorf("MQTT 5 mismatch")
+	}
+
+	txs := newSignedTransactions(t, 1)
+	tx, err := newPendingTransferTx(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish := mqtt5Publish("newchain/abc/0", []byte("{}"), n.publishOptions(tx, 0))
+	if publish.QoS != 1 || publish.Properties.ContentType != "application/json" ||
+		string(publish.Properties.CorrelationData) != string(tx.Hash.Bytes()) {
+		t.Errorf("publish mismatch: %+v", publish)
+	}
+	if publish.Properties.MessageExpiry == nil || *publish.Properties.MessageExpiry != 90 {
+		t.Errorf("message expiry mismatch: %v", publish.Properties.MessageExpiry)
+	}
+	want := paho.UserProperties{{Key: "event", Value: EventPending}, {Key: "chainId", Value: "1012"}, {Key: "confirmations", Value: "0"}}
+	if len(publish.Properties.User) != len(want) {
+		t.Fatalf("user properties mismatch: have %v, want %v", publish.Properties.User, want)
+	}
+	for i := range want {
+		if publish.Properties.User[i] != want[i] {
+			t.Errorf("user property mismatch: have %v, want %v", publish.Properties.User[i], want[i])
+		}
+	}
+
+	// the confirmed notifications never expire
+	tx.BlockNumber = big.NewInt(1)
+	publish = mqtt5Publish("Transfer", []byte("{}"), n.publishOptions(tx, -1))
+	if publish.Properties.MessageExpiry != nil || publish.Properties.User.Get("event") != EventConfirmed ||
+		publish.Properties.User.Get("confirmations") != "" {
+		t.Errorf("confirmed publish mismatch: %+v", publish.Properties)
+	}
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// natsSubject maps the topic to the NATS subject, by the / separators to dots
+// and the MQTT wildcards + and # to * and >
+func natsSubject(topic string) string {
+	return dotTopic(topic, "*", ">")
+}
+
+// natsDurable is the durable consumer name by the client ID, which can not contain dots
+func natsDurable(clientID string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(clientID)
+}
+
+// connectNATS connects to the NATS server by the config, and reconnects for ever
+func connectNATS(c *NotifyConfig) (*nats.Conn, error) {
+	opts := []nats.Option{
+		nats.Name(c.ClientID),
+		nats.MaxReconnects(-1),
+	}
+	if c.Username != "" {
+		opts = append(opts, nats.UserInfo(c.Username, c.Password))
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	return nats.Connect(c.Server, opts...)
+}
+
+// natsPublisher publishes to the NATS subjects, by JetStream if the stream is set
+type natsPublisher struct {
+	nc *nats.Conn
+	js nats.JetStreamContext
+}
+
+// NewNATSPublisher connects to the NATS server of the config. If the JetStream of
+// the config is set, the messages are published by JetStream and the delivery is
+// confirmed by the stream, otherwise by the flush to the server.
+func NewNATSPublisher(c *NotifyConfig) (Publisher, error) {
+	nc, err := connectNATS(c)
+	if err != nil {
+		return nil, err
+	}
+	p := &natsPublisher{nc: nc}
+	if c.JetStream != "" {
+		js, err := nc.JetStream()
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		if _, err := js.StreamInfo(c.JetStream); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		p.js = js
+	}
+
+	return p, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	subject := natsSubject(topic)
+	if p.js != nil {
+		var pubOpts []nats.PubOpt
+		if _, ok := ctx.Deadline(); ok {
+			pubOpts = append(pubOpts, nats.Context(ctx))
+		}
+		_, err := p.js.Publish(subject, payload, pubOpts...)
+		return err
+	}
+
+	if err := p.nc.Publish(subject, payload); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return p.nc.FlushWithContext(ctx)
+	}
+	return p.nc.Flush()
+}
+
+func (p *natsPublisher) Close() error {
+	if err := p.nc.Drain(); err != nil {
+		p.nc.Close()
+		return err
+	}
+	return nil
+}
+
+// natsAckHandler handles the JetStream message by f, and acknowledges it once
+// handled, or negatively acknowledges it to be delivered again if failed
+func natsAckHandler(logger *log.Logger, topic string, f messageHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		if err := f(topic, msg.Data); err != nil {
+			logger.Warnf("NATS message not handled, deliver again: %v", err)
+			if err := msg.Nak(); err != nil {
+				logger.Errorln(err)
+			}
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			logger.Errorln(err)
+		}
+	}
+}
+
+// runNATSSubscribe subscribes the subject of the topic till quit. If the JetStream
+// of the config is set, the messages are consumed by the durable consumer named
+// by the client ID, acknowledged once handled, or negatively acknowledged to be
+// delivered again if failed.
+func (n *Notify) runNATSSubscribe(f messageHandler) error {
+	var nc *nats.Conn
+	if err := n.retryConnect("NATS", func() (err error) {
+		nc, err = connectNATS(n.s)
+		return err
+	}); err != nil {
+		if err == errQuit {
+			return nil
+		}
+		n.quit <- struct{}{}
+		return err
+	}
+	defer nc.Close()
+	// the client connects and subscribes again by itself
+	nc.SetDisconnectErrHandler(func(_ *nats.Conn, err error) {
+		setSubscriberConnected(false)
+		n.Logger.Warnf("NATS connection lost: %v", err)
+	})
+	nc.SetReconnectHandler(func(*nats.Conn) {
+		setSubscriberConnected(true)
+		n.Logger.Info("NATS Reconnected...")
+	})
+
+	var err error
+	subject := natsSubject(n.s.Topic)
+	if n.s.JetStream == "" {
+		_, err = nc.Subscribe(subject, func(msg *nats.Msg) {
+			f(n.s.Topic, msg.Data)
+		})
+	} else {
+		var js nats.JetStreamContext
+		js, err = nc.JetStream()
+		if err == nil {
+			_, err = js.Subscribe(subject, natsAckHandler(n.Logger, n.s.Topic, f),
+				nats.BindStream(n.s.JetStream), nats.Durable(natsDurable(n.s.ClientID)), nats.ManualAck())
+		}
+	}
+	if err != nil {
+		n.quit <- struct{}{}
+		return err
+	}
+	setSubscriberConnected(true)
+	n.Logger.Info("NATS Connected...")
+
+	<-n.quit
+	return nil
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestNATSSubject(t *testing.T) {
+	tests := []struct {
+		topic, subject string
+	}{
+		{"RawTransaction", "RawTransaction"},
+		{"newchain/97549e368acafdcae786bb93d98379f1d1561a29/4", "newchain.97549e368acafdcae786bb93d98379f1d1561a29.4"},
+		{"newchain/ContractCreate", "newchain.ContractCreate"},
+		{"newchain/+/4", "newchain.*.4"},
+		{"/newchain/#", "newchain.>"},
+	}
+	for _, tt := range tests {
+		if subject := natsSubject(tt.topic); subject != tt.subject {
+			t.Errorf("subject of %s: have %s, want %s", tt.topic, subject, tt.subject)
+		}
+	}
+}
+
+// fakeJetStream is a NATS server which delivers a message with the reply subject,
+// and delivers it again once negatively acknowledged, as a JetStream consumer does
+type fakeJetStream struct {
+	l    net.Listener
+	acks chan string
+}
+
+func newFakeJetStream(t *testing.T) *fakeJetStream {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeJetStream{l: l, acks: make(chan string, 10)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeJetStream) serve() {
+	conn, err := s.l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+
+	const reply = "$JS.ACK.test"
+	deliver := func(subject, sid string) {
+		payload := `{"hash":"0x01"}`
+		fmt.Fprintf(conn, "MSG %s %s %s %d\r\n%s\r\n", subject, sid, reply, len(payload), payload)
+	}
+	var subject, sid string
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "SUB":
+			subject, sid = fields[1], fields[len(fields)-1]
+			deliver(subject, sid)
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			ack := string(payload[:size])
+			s.acks <- ack
+			if fields[1] == reply && ack == "-NAK" {
+				deliver(subject, sid)
+			}
+		}
+	}
+}
+
+func TestNATSAckHandler(t *testing.T) {
+	s := newFakeJetStream(t)
+	defer s.l.Close()
+
+	nc, err := nats.Connect("nats://" + s.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	// the first delivery fails and is delivered again
+	var handled int
+	f := func(topic string, payload []byte) error {
+		handled++
+		if handled == 1 {
+			return errors.New("not handled")
+		}
+		return nil
+	}
+	if _, err := nc.Subscribe("newchain.abc.4", natsAckHandler(log.New(), "newchain/abc/4", f)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"-NAK", "+ACK"} {
+		select {
+		case ack := <-s.acks:
+			if ack != want {
+				t.Errorf("ack mismatch: have %s, want %s", ack, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+	if handled != 2 {
+		t.Errorf("handled mismatch: have %v, want %v", handled, 2)
+	}
+}
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/newtonproject/newchain-notify/queue"
+)
+
+const (
+	// NodePendingSubscribe gets pending transactions by eth_subscribe("newPendingTransactions")
+	NodePendingSubscribe = "subscribe"
+	// NodePendingTxPool gets pending transactions by polling txpool_content
+	NodePendingTxPool = "txpool"
+
+	defaultNodePendingInterval = time.Second
+	nodeResubscribePolls       = 60 // the polls of txpool_content before subscribing again
+	defaultSeenSize            = 16384
+)
+
+// NodePendingConfig is the config to get pending transactions from the node
+type NodePendingConfig struct {
+	Mode     string        // subscribe or txpool
+	Interval time.Duration // the interval to poll txpool_content
+}
+
+// poolTx is the transaction format returned by txpool_content
+type poolTx struct {
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Hash  common.Hash     `json:"hash"`
+}
+
+// hashSet remembers the latest size hashes, the oldest will be forgotten first
+type hashSet struct {
+	size   int
+	hashes map[common.Hash]struct{}
+	order  *queue.Queue
+}
+
+func newHashSet(size int) *hashSet {
+	return &hashSet{
+		size:   size,
+		hashes: make(map[common.Hash]struct{}),
+		order:  queue.New(),
+	}
+}
+
+// Has returns whether the hash is in the set
+func (s *hashSet) Has(hash common.Hash) bool {
+	_, ok := s.hashes[hash]
+	return ok
+}
+
+// Add adds the hash to the set, return false if the hash already in the set
+func (s *hashSet) Add(hash common.Hash) bool {
+	if _, ok := s.hashes[hash]; ok {
+		return false
+	}
+	s.hashes[hash] = struct{}{}
+	s.order.Push(hash)
+	for s.order.Size() > s.size {
+		delete(s.hashes, s.order.Pop().(common.Hash))
+	}
+
+	return true
+}
+
+func (n *PendingNotify) runNodePending(txCh chan<- *TransferTx) {
+	c := n.dialNode()
+
+	interval := n.nodePending.Interval
+	if interval <= 0 {
+		interval = defaultNodePendingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pool map[common.Hash]struct{}
+	for {
+		polls := 0
+		if n.nodePending.Mode == NodePendingSubscribe {
+			err := n.subscribeNodePending(c, txCh)
+			n.Logger.Warnf("%s: %v, try to poll txpool_content", n.rpcURL, err)
+			polls = nodeResubscribePolls
+		}
+
+		n.Logger.Info("Polling pending transactions from txpool_content...")
+		// poll forever in the txpool mode, or some times before subscribing again
+		for i := 0; polls == 0 || i < polls; i++ {
+			<-ticker.C
+			var err error
+			if pool, err = n.pollTxPool(c, txCh, pool); err != nil {
+				n.Logger.Errorln(err)
+			}
+		}
+	}
+}
+
+// dialNode dials the node with backoff till it succeeds
+func (n *PendingNotify) dialNode() *rpc.Client {
+	for backoff := minReconnectBackoff; ; {
+		c, err := rpc.Dial(n.rpcURL)
+		if err == nil {
+			return c
+		}
+		n.Logger.Errorf("dial %s failed, retry in %v: %v", n.rpcURL, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// subscribeNodePending only return when the node not support subscribe
+func (n *PendingNotify) subscribeNodePending(c *rpc.Client, txCh chan<- *TransferTx) error {
+	ec := ethclient.NewClient(c)
+	ctx := context.Background()
+
+	for {
+		hashCh := make(chan common.Hash, 1024)
+		sub, err := c.EthSubscribe(ctx, hashCh, "newPendingTransactions")
+		if err == rpc.ErrNotificationsUnsupported {
+			return err
+		}
+		if err != nil {
+			n.Logger.Errorln(err)
+			time.Sleep(defaultNodePendingInterval)
+			continue
+		}
+		n.Logger.Info("Subscribed newPendingTransactions from node...")
+
+	loop:
+		for {
+			select {
+			case hash := <-hashCh:
+				tx, _, err := ec.TransactionByHash(ctx, hash)
+				if err != nil {
+					n.Logger.Debugln(err, hash.String())
+					continue
+				}
+				aTx, err := newPendingTransferTx(tx)
+				if err != nil {
+					n.Logger.Errorln(err)
+					continue
+				}
+				txCh <- aTx
+			case err := <-sub.Err():
+				n.Logger.Errorln("newPendingTransactions subscription:", err)
+				break loop
+			}
+		}
+		time.Sleep(defaultNodePendingInterval)
+	}
+}
+
+// pollTxPool sends the transactions not in the pool of the last poll, and returns the
+// hashes of the pool now. The transactions are sent once while they stay in the pool,
+// however many the pool holds, and again only after they are removed and added back.
+func (n *PendingNotify) pollTxPool(c *rpc.Client, txCh chan<- *TransferTx, last map[common.Hash]struct{}) (map[common.Hash]struct{}, error) {
+	var content struct {
+		Pending map[string]map[string]*poolTx `json:"pending"`
+	}
+	if err := c.CallContext(context.Background(), &content, "txpool_content"); err != nil {
+		return last, err
+	}
+
+	pool := make(map[common.Hash]struct{})
+	for _, txs := range content.Pending {
+		for _, tx := range txs {
+			if tx == nil {
+				continue
+			}
+			pool[tx.Hash] = struct{}{}
+			if _, ok := last[tx.Hash]; ok {
+				continue
+			}
+			txCh <- &TransferTx{
+				From:  tx.From,
+				To:    tx.To,
+				Value: (*big.Int)(tx.Value),
+				Hash:  tx.Hash,
+			}
+		}
+	}
+
+	return pool, nil
+}
+
+func newPendingTransferTx(tx *types.Transaction) (*TransferTx, error) {
+	if tx == nil {
+		return nil, errors.New("tx is nil")
+	}
+	signer := types.NewEIP155Signer(tx.ChainId())
+	from, err := signer.Sender(tx)
+	if err != nil {
+		return nil, err
+	}
+	if from == (common.Address{}) {
+		return nil, errors.New("from address is nil")
+	}
+
+	return &TransferTx{
+		From:  from,
+		To:    tx.To(),
+		Value: tx.Value(),
+		Hash:  tx.Hash(),
+	}, nil
+}
@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestHashSet(t *testing.T) {
+	s := newHashSet(2)
+	a, b, c := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+
+	if !s.Add(a) || !s.Add(b) {
+		t.Fatal("new hash not added")
+	}
+	if s.Add(a) || s.Add(b) {
+		t.Fatal("seen hash added again")
+	}
+	// the oldest is forgotten once full
+	if !s.Add(c) {
+		t.Fatal("new hash not added")
+	}
+	if s.Add(b) || s.Add(c) {
+		t.Fatal("seen hash added again")
+	}
+	if !s.Add(a) {
+		t.Fatal("forgotten hash not added")
+	}
+}
+
+// TxPoolService serves txpool_content of the pending transactions
+type TxPoolService struct {
+	pending map[string]map[string]*poolTx
+}
+
+func (s *TxPoolService) Content() map[string]map[string]map[string]*poolTx {
+	return map[string]map[string]map[string]*poolTx{"pending": s.pending}
+}
+
+func TestPollTxPool(t *testing.T) {
+	pool := &TxPoolService{pending: make(map[string]map[string]*poolTx)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("txpool", pool); err != nil {
+		t.Fatal(err)
+	}
+	c := rpc.DialInProc(server)
+	defer c.Close()
+
+	from := common.HexToAddress("0xe028d0363813d19d8c76886bd6b32dacf50b7a6d")
+	setPool := func(hashes ...common.Hash) {
+		txs := make(map[string]*poolTx)
+		for i, hash := range hashes {
+			txs[hexutil.EncodeUint64(uint64(i))] = &poolTx{From: from, Value: (*hexutil.Big)(common.Big1), Hash: hash}
+		}
+		pool.pending = map[string]map[string]*poolTx{from.Hex(): txs}
+	}
+
+	// the pool holds more transactions than the seen set
+	var hashes []common.Hash
+	for i := 0; i < 10; i++ {
+		hashes = append(hashes, common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	n := &PendingNotify{seen: newHashSet(2)}
+	poll := func(last map[common.Hash]struct{}) (map[common.Hash]struct{}, []common.Hash) {
+		txCh := make(chan *TransferTx, len(hashes))
+		last, err := n.pollTxPool(c, txCh, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(txCh)
+		var sent []common.Hash
+		for tx := range txCh {
+			sent = append(sent, tx.Hash)
+		}
+		return last, sent
+	}
+
+	setPool(hashes...)
+	last, sent := poll(nil)
+	if len(sent) != len(hashes) {
+		t.Fatalf("sent %d transactions, want %d", len(sent), len(hashes))
+	}
+	if last, sent = poll(last); len(sent) != 0 {
+		t.Fatalf("sent %d transactions again, want none", len(sent))
+	}
+
+	// only the transaction added is sent, also after removed and added back
+	setPool(hashes[1:]...)
+	if last, sent = poll(last); len(sent) != 0 {
+		t.Fatalf("sent %d transactions after removed, want none", len(sent))
+	}
+	setPool(hashes...)
+	if _, sent = poll(last); len(sent) != 1 || sent[0] != hashes[0] {
+		t.Fatalf("sent %v after added, want %s", sent, hashes[0].Hex())
+	}
+}
+
+func TestDialNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	endpoint := filepath.Join(dir, "node.ipc")
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	go func() {
+		// the node is up only after the first dial fails
+		time.Sleep(100 * time.Millisecond)
+		l, err := net.Listen("unix", endpoint)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server.ServeListener(l)
+	}()
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	n := &PendingNotify{rpcURL: endpoint, Notify: Notify{Logger: logger}}
+	c := n.dialNode()
+	defer c.Close()
+	var modules map[string]string
+	if err := c.Call(&modules, "rpc_modules"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pollingHook sends to the channel when polling txpool_content begins
+type pollingHook chan struct{}
+
+func (h pollingHook) Levels() []log.Level { return []log.Level{log.InfoLevel} }
+
+func (h pollingHook) Fire(e *log.Entry) error {
+	if strings.HasPrefix(e.Message, "Polling pending transactions") {
+		h <- struct{}{}
+	}
+	return nil
+}
+
+func TestNodePendingResubscribe(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("txpool", &TxPoolService{}); err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	polling := make(pollingHook)
+	logger.AddHook(polling)
+	n := &PendingNotify{
+		rpcURL:      s.URL,
+		nodePending: &NodePendingConfig{Mode: NodePendingSubscribe, Interval: time.Millisecond},
+		Notify:      Notify{Logger: logger},
+	}
+	go n.runNodePending(make(chan *TransferTx))
+
+	// the node over HTTP not supports subscribe, so it is subscribed again after the polls
+	for i := 0; i < 2; i++ {
+		select {
+		case <-polling:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("polling %d not begin", i)
+		}
+	}
+}
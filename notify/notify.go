@@ -1,16 +1,20 @@
 package notify
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-notify/address"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -27,12 +31,82 @@ type NotifyConfig struct {
 	QoS         byte
 	Topic       string
 	PrefixTopic string // for publish and only for n_address
+	Format      string `json:",omitempty"` // for subscribe raw transaction only
+	JetStream   string `json:",omitempty"` // the JetStream stream for NATS, empty for core NATS
+	Exchange    string `json:",omitempty"` // the topic exchange for AMQP, default amq.topic
+
+	// connection settings, for subscribe only
+	CleanSession         bool          `json:",omitempty"` // start a clean session, otherwise the broker keeps the session of the ClientID and queues the QoS 1 and 2 messages while disconnected
+	ConnectRetries       int           `json:",omitempty"` // the retries of the first connect, 0 for unlimited, -1 for none
+	MaxReconnectInterval time.Duration `json:",omitempty"` // the max backoff to connect again, default 1m
+
+	// delivery settings, for publish only
+	PublishTimeout time.Duration `json:",omitempty"` // the timeout of each publish, default 10s
+	Outbox         string        `json:",omitempty"` // the path of the outbox to keep the messages failed to publish, in memory if empty
+	StatusTopic    string        `json:",omitempty"` // the retained status topic and the last will of the service, none if empty
+	StatusInterval time.Duration `json:",omitempty"` // the interval to refresh the status, default 30s
+
+	// topic templates of the address topics on the broker, for publish only
+	TopicTemplate          string `json:",omitempty"` // default {prefix}{address}/{confirmations}
+	ContractCreateTemplate string `json:",omitempty"` // default {prefix}ContractCreate
+	NEWAddress             bool   `json:",omitempty"` // add the NEW addresses of the ChainID to the payloads
+
+	// MQTT 5 settings
+	MQTTVersion   uint          `json:",omitempty"` // 3 for MQTT 3.1, 4 for MQTT 3.1.1, 5 for the MQTT 5 client, default MQTT 3.1.1
+	MessageExpiry time.Duration `json:",omitempty"` // the expiry of the pending notifications, only for MQTT 5
+	ChainID       uint64        `json:",omitempty"` // the chain ID of the user properties, only for MQTT 5
+
+	// TLS settings, for ssl:// MQTT and the other transports over TLS
+	CAFile             string `json:",omitempty"` // the CA bundle to verify the server, default the system roots
+	CertFile           string `json:",omitempty"` // the client certificate for mutual TLS
+	KeyFile            string `json:",omitempty"` // the key of the client certificate
+	ServerName         string `json:",omitempty"` // the server name to verify, default the host of the server
+	InsecureSkipVerify bool   `json:",omitempty"`
+}
+
+const (
+	transportMQTT  = "mqtt"
+	transportNATS  = "nats"
+	transportAMQP  = "amqp"
+	transportSTOMP = "stomp"
+
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
+// transportOf returns the transport of the server by its URL scheme, MQTT by default
+func transportOf(server string) string {
+	server = strings.ToLower(server)
+	switch {
+	case strings.HasPrefix(server, "nats://"):
+		return transportNATS
+	case strings.HasPrefix(server, "amqp://"), strings.HasPrefix(server, "amqps://"):
+		return transportAMQP
+	case strings.HasPrefix(server, "stomp://"):
+		return transportSTOMP
+	default:
+		return transportMQTT
+	}
 }
 
 type Notify struct {
 	s *NotifyConfig
 	p *NotifyConfig
 
+	// Publisher is the transport to publish to, the MQTT publisher by the publish config if nil
+	Publisher Publisher
+	sinks     []Publisher // published to in parallel with the Publisher
+	outbox    *outbox     // the outbox of the Publisher
+	primary   Publisher   // the Publisher without the outbox, to publish the status
+
+	// the topic templates of the address topics on the broker
+	topicTemplate  *TopicTemplate
+	createTemplate *TopicTemplate
+
+	// Version is the version of the service in the status
+	Version string
+	status  *serviceStatus
+
 	Logger *log.Logger
 	quit   chan struct{}
 }
@@ -44,15 +118,22 @@ type TransferTx struct {
 	Hash        common.Hash     `json:"hash"`
 	Data        []byte          `json:"data"`
 	BlockNumber *big.Int        `json:"blockNumber"`
+	Status      *uint64         `json:"status,omitempty"`  // the receipt status, only for receipt confirm mode
+	Event       string          `json:"event,omitempty"`   // empty for pending and confirmed
+	NewFrom     string          `json:"newFrom,omitempty"` // the NEW address of From, only if NEWAddress is set
+	NewTo       string          `json:"newTo,omitempty"`   // the NEW address of To, only if NEWAddress is set
+
+	Meta map[string]json.RawMessage `json:"meta,omitempty"` // the envelope metadata of raw transaction
 }
 
 // UnmarshalJSON decodes from json format to a TransferTx.
 func (c *TransferTx) UnmarshalJSON(data []byte) error {
 	type Tx struct {
-		From  common.Address  `json:"from"`
-		To    *common.Address `json:"to"`
-		Value string          `json:"value"`
-		Hash  common.Hash     `json:"hash"`
+		From  common.Address             `json:"from"`
+		To    *common.Address            `json:"to"`
+		Value string                     `json:"value"`
+		Hash  common.Hash                `json:"hash"`
+		Meta  map[string]json.RawMessage `json:"meta"`
 	}
 	var tx Tx
 	err := json.Unmarshal(data, &tx)
@@ -67,6 +148,7 @@ func (c *TransferTx) UnmarshalJSON(data []byte) error {
 	}
 	c.Value = value
 	c.Hash = tx.Hash
+	c.Meta = tx.Meta
 
 	return nil
 }
@@ -74,12 +156,17 @@ func (c *TransferTx) UnmarshalJSON(data []byte) error {
 // MarshalJSON encodes to json format.
 func (c *TransferTx) MarshalJSON() ([]byte, error) {
 	type Tx struct {
-		From        common.Address  `json:"from"`
-		To          *common.Address `json:"to"`
-		Value       *hexutil.Big    `json:"value"`
-		Hash        common.Hash     `json:"hash"`
-		Data        hexutil.Bytes   `json:"data"`
-		BlockNumber *hexutil.Big    `json:"blockNumber"`
+		From        common.Address             `json:"from"`
+		To          *common.Address            `json:"to"`
+		Value       *hexutil.Big               `json:"value"`
+		Hash        common.Hash                `json:"hash"`
+		Data        hexutil.Bytes              `json:"data"`
+		BlockNumber *hexutil.Big               `json:"blockNumber"`
+		Status      *hexutil.Uint64            `json:"status,omitempty"`
+		Event       string                     `json:"event,omitempty"`
+		NewFrom     string                     `json:"newFrom,omitempty"`
+		NewTo       string                     `json:"newTo,omitempty"`
+		Meta        map[string]json.RawMessage `json:"meta,omitempty"`
 	}
 
 	enc := &Tx{
@@ -89,92 +176,457 @@ func (c *TransferTx) MarshalJSON() ([]byte, error) {
 		Hash:        c.Hash,
 		Data:        c.Data,
 		BlockNumber: (*hexutil.Big)(c.BlockNumber),
+		Status:      (*hexutil.Uint64)(c.Status),
+		Event:       c.Event,
+		NewFrom:     c.NewFrom,
+		NewTo:       c.NewTo,
+		Meta:        c.Meta,
 	}
 
 	return json.Marshal(&enc)
 }
 
-func (n *Notify) runSubscribeClient(f func(c mqtt.Client, message mqtt.Message)) error {
+// messageHandler handles the subscribed message and returns once it is handled. The
+// message is acknowledged if it returns nil, otherwise it is handled again.
+type messageHandler func(topic string, payload []byte) error
+
+// received is the subscribed message, done receives the result of handling it
+type received struct {
+	payload []byte
+	done    chan<- error
+}
+
+// runSubscribeClient subscribes the topic by the transport of the server
+func (n *Notify) runSubscribeClient(f messageHandler) error {
 	if n.s.Topic == "" {
 		n.quit <- struct{}{}
 		return errors.New("not all topic set")
 	}
+	handle := f
+	f = func(topic string, payload []byte) error {
+		subscriberMetrics.Add(metricMessages, 1)
+		return handle(topic, payload)
+	}
+	if isMQTT5(n.s) {
+		return n.runMQTT5Subscribe(f)
+	}
+	switch transportOf(n.s.Server) {
+	case transportNATS:
+		return n.runNATSSubscribe(f)
+	case transportAMQP:
+		return n.runReconnect("AMQP", func() (<-chan error, error) {
+			return n.subscribeAMQP(f)
+		})
+	case transportSTOMP:
+		return n.runReconnect("STOMP", func() (<-chan error, error) {
+			return n.subscribeSTOMP(f)
+		})
+	}
 
 	if n.Logger != nil {
 		mqtt.ERROR = errorLogger{n.Logger}
 	}
+	tlsConfig, err := n.s.TLSConfig()
+	if err != nil {
+		n.quit <- struct{}{}
+		return err
+	}
+	// the client acknowledges the message itself once the handler returns, which
+	// can not be disabled, so the failed message is retried till it is handled
+	onMessageReceived := func(c mqtt.Client, message mqtt.Message) {
+		if message != nil {
+			n.retryHandle(f, message.Topic(), message.Payload())
+		}
+	}
 	opts := mqtt.NewClientOptions().AddBroker(n.s.Server).SetClientID(n.s.ClientID)
 	opts.SetUsername(n.s.Username)
 	opts.SetPassword(n.s.Password)
+	opts.SetProtocolVersion(n.s.MQTTVersion)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	// the broker queues the QoS 1 and 2 messages of the persistent session while
+	// disconnected, which may arrive before subscribing again
+	opts.SetCleanSession(n.s.CleanSession)
+	opts.SetDefaultPublishHandler(onMessageReceived)
+	opts.SetMaxReconnectInterval(n.reconnectInterval())
+	opts.OnConnectionLost = func(c mqtt.Client, err error) {
+		setSubscriberConnected(false)
+		n.Logger.Warnf("MQTT connection lost: %v", err)
+	}
 	opts.OnConnect = func(c mqtt.Client) {
-		if token := c.Subscribe(n.s.Topic, n.s.QoS, f); token.Wait() && token.Error() != nil {
-			n.Logger.Errorln(token.Error())
-			n.quit <- struct{}{}
-			return
+		setSubscriberConnected(true)
+		for backoff := minReconnectBackoff; c.IsConnected(); {
+			token := c.Subscribe(n.s.Topic, n.s.QoS, onMessageReceived)
+			if token.Wait() && token.Error() == nil {
+				n.Logger.Info("MQTT Connected/Reconnected...")
+				return
+			}
+			subscriberMetrics.Add(metricSubscribeErrors, 1)
+			n.Logger.Errorf("MQTT subscribe %s failed, retry in %v: %v", n.s.Topic, backoff, token.Error())
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > n.reconnectInterval() {
+				backoff = n.reconnectInterval()
+			}
 		}
-		n.Logger.Info("ActiveMQ Connected/Reconnected...")
 	}
 
 	c := mqtt.NewClient(opts)
-	go func() {
-		if token := c.Connect(); token.Wait() && token.Error() != nil {
-			n.Logger.Errorln(token.Error())
-			n.quit <- struct{}{}
+	if err := n.retryConnect("MQTT", func() error {
+		token := c.Connect()
+		token.Wait()
+		return token.Error()
+	}); err != nil {
+		if err == errQuit {
+			return nil
+		}
+		n.quit <- struct{}{}
+		return err
+	}
+
+	<-n.quit
+	c.Disconnect(250)
+	return nil
+}
+
+// errQuit is returned by retryConnect if quit while retrying
+var errQuit = errors.New("quit")
+
+// reconnectInterval returns the max backoff to connect again of the subscribe config
+func (n *Notify) reconnectInterval() time.Duration {
+	if n.s.MaxReconnectInterval > 0 {
+		return n.s.MaxReconnectInterval
+	}
+	return maxReconnectBackoff
+}
+
+// retryConnect connects by the connect function with backoff, till it succeeds,
+// the ConnectRetries of the subscribe config run out, or quit.
+func (n *Notify) retryConnect(name string, connect func() error) error {
+	backoff := minReconnectBackoff
+	for retries := 0; ; retries++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		subscriberMetrics.Add(metricConnectErrors, 1)
+		if n.s.ConnectRetries < 0 || (n.s.ConnectRetries > 0 && retries >= n.s.ConnectRetries) {
+			return err
+		}
+		n.Logger.Warnf("%s connect failed, retry in %v: %v", name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-n.quit:
+			return errQuit
+		}
+		if backoff *= 2; backoff > n.reconnectInterval() {
+			backoff = n.reconnectInterval()
+		}
+	}
+}
+
+// retryHandle handles the message by f with backoff till it succeeds, for the clients
+// which acknowledge the message once the handler returns.
+func (n *Notify) retryHandle(f messageHandler, topic string, payload []byte) {
+	for backoff := minReconnectBackoff; ; {
+		err := f(topic, payload)
+		if err == nil {
 			return
 		}
-	}()
+		n.Logger.Errorf("handle the message of %s failed, retry in %v: %v", topic, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > n.reconnectInterval() {
+			backoff = n.reconnectInterval()
+		}
+	}
+}
+
+// runReconnect subscribes by the subscribe function, which returns the channel
+// of the connection lost error, and subscribes again with backoff till quit.
+func (n *Notify) runReconnect(name string, subscribe func() (<-chan error, error)) error {
+	var lost <-chan error
+	if err := n.retryConnect(name, func() (err error) {
+		lost, err = subscribe()
+		return err
+	}); err != nil {
+		if err == errQuit {
+			return nil
+		}
+		n.quit <- struct{}{}
+		return err
+	}
+	setSubscriberConnected(true)
+	n.Logger.Infof("%s Connected...", name)
+
+	for {
+		select {
+		case err := <-lost:
+			setSubscriberConnected(false)
+			n.Logger.Warnf("%s connection lost: %v", name, err)
+		case <-n.quit:
+			return nil
+		}
+
+		for backoff := minReconnectBackoff; ; {
+			select {
+			case <-time.After(backoff):
+			case <-n.quit:
+				return nil
+			}
+			var err error
+			if lost, err = subscribe(); err == nil {
+				break
+			}
+			subscriberMetrics.Add(metricConnectErrors, 1)
+			n.Logger.Errorln(err)
+			if backoff *= 2; backoff > n.reconnectInterval() {
+				backoff = n.reconnectInterval()
+			}
+		}
+		setSubscriberConnected(true)
+		n.Logger.Infof("%s Reconnected...", name)
+	}
+}
 
-	select {
-	case <-n.quit:
-		return nil
+func (n *Notify) publish(p Publisher, tx *TransferTx) error {
+	return n.publishToTopic(p, n.p.Topic, tx)
+}
+
+// publishToTopic publishes the transaction and returns the error if the delivery is not confirmed
+func (n *Notify) publishToTopic(p Publisher, topic string, tx *TransferTx) error {
+	return n.publishMessage(p, topic, tx, -1)
+}
+
+// publishToBlockTopic publishes the transaction to the address topic by the topic
+// template on the broker, and by the default layout to the sinks
+func (n *Notify) publishToBlockTopic(p Publisher, tx *TransferTx, block int64) error {
+	return n.publishRouted(p, n.blockTopic(tx, block), n.brokerTopic(tx, block), tx, block)
+}
+
+// eventOf returns the event of the transaction, pending or confirmed if not set
+func eventOf(tx *TransferTx) string {
+	if tx.Event != "" {
+		return tx.Event
+	}
+	if tx.BlockNumber == nil {
+		return EventPending
+	}
+	return EventConfirmed
+}
+
+// publishOptions returns the options of the transaction with the properties, the
+// confirmations is -1 if unknown
+func (n *Notify) publishOptions(tx *TransferTx, confirmations int64) *PublishOptions {
+	event := eventOf(tx)
+	if confirmations < 0 && event == EventPending {
+		confirmations = 0
+	}
+
+	opts := &PublishOptions{
+		QoS:             n.p.QoS,
+		ContentType:     "application/json",
+		CorrelationData: tx.Hash.Bytes(),
+		UserProperties:  []UserProperty{{Key: "event", Value: event}},
+	}
+	if n.p.ChainID != 0 {
+		opts.UserProperties = append(opts.UserProperties, UserProperty{Key: "chainId", Value: strconv.FormatUint(n.p.ChainID, 10)})
+	}
+	if confirmations >= 0 {
+		opts.UserProperties = append(opts.UserProperties, UserProperty{Key: "confirmations", Value: strconv.FormatInt(confirmations, 10)})
 	}
+	if event == EventPending {
+		opts.MessageExpiry = n.p.MessageExpiry
+	}
+
+	return opts
+}
+
+// publishMessage publishes the transaction with the confirmations, -1 if unknown
+func (n *Notify) publishMessage(p Publisher, topic string, tx *TransferTx, confirmations int64) error {
+	return n.publishRouted(p, topic, topic, tx, confirmations)
 }
 
-func (n *Notify) publish(c mqtt.Client, tx *TransferTx) {
-	if c == nil {
-		n.Logger.Error("publish client is nil")
-		return
+// publishRouted publishes the transaction to the broker topic, and to the topic for
+// the sinks if the publisher routes them apart
+func (n *Notify) publishRouted(p Publisher, topic, brokerTopic string, tx *TransferTx, confirmations int64) error {
+	if p == nil {
+		n.Logger.Error("publisher is nil")
+		return errors.New("publisher is nil")
+	}
+	if n.p.NEWAddress {
+		n.setNEWAddress(tx)
 	}
 	payload, err := json.Marshal(tx)
 	if err != nil {
 		n.Logger.Error(err)
-		return
+		return err
 	}
 	n.Logger.WithFields(log.Fields{
-		"publish": n.p.Topic,
+		"publish": brokerTopic,
 	}).Info(string(payload))
 
-	c.Publish(n.p.Topic, n.p.QoS, false, string(payload))
+	timeout := n.p.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	opts := n.publishOptions(tx, confirmations)
+	if r, ok := p.(*routePublisher); ok {
+		err = r.publishRouted(ctx, brokerTopic, topic, payload, opts)
+	} else {
+		err = p.Publish(ctx, brokerTopic, payload, opts)
+	}
+	if err != nil {
+		n.Logger.WithFields(log.Fields{
+			"publish": brokerTopic,
+		}).Errorln(err)
+		return err
+	}
+
+	return nil
 }
 
-func (n *Notify) publishToBlockTopic(c mqtt.Client, tx *TransferTx, block int64) {
-	if c == nil {
-		n.Logger.Error("publish client is nil")
-		return
+// setNEWAddress sets the NEW addresses of the transaction by the ChainID
+func (n *Notify) setNEWAddress(tx *TransferTx) {
+	tx.NewFrom = address.ToNEW(tx.From, n.p.ChainID)
+	tx.NewTo = ""
+	if tx.To != nil {
+		tx.NewTo = address.ToNEW(*tx.To, n.p.ChainID)
 	}
-	payload, err := json.Marshal(tx)
-	if err != nil {
-		n.Logger.Error(err)
-		return
+}
+
+// blockTopic is the address topic of the transaction confirmed by the block
+func (n *Notify) blockTopic(tx *TransferTx, block int64) string {
+	if tx.To == nil {
+		return fmt.Sprintf("%sContractCreate", n.p.PrefixTopic)
 	}
-	var topic string
+
+	return fmt.Sprintf("%s%s/%d", n.p.PrefixTopic, strings.ToLower(tx.To.String()[2:]), block)
+}
+
+// brokerTopic is the address topic of the transaction on the broker by the topic
+// templates, the default layout if not parsed
+func (n *Notify) brokerTopic(tx *TransferTx, block int64) string {
+	if n.topicTemplate == nil || n.createTemplate == nil {
+		return n.blockTopic(tx, block)
+	}
+
+	v := n.topicValues(tx)
+	v.confirmations = block
 	if tx.To == nil {
-		topic = fmt.Sprintf("%sContractCreate", n.p.PrefixTopic)
-	} else {
-		topic = fmt.Sprintf("%s%s/%d", n.p.PrefixTopic, strings.ToLower(tx.To.String()[2:]), block)
+		return n.createTemplate.render(v)
 	}
+	return n.topicTemplate.render(v)
+}
 
-	n.Logger.WithFields(log.Fields{
-		"publish": topic,
-	}).Info(string(payload))
+// publishToEventTopic publishes the event of the transaction sent to an address to the
+// address topic of the event, apart from the confirmation topics
+func (n *Notify) publishToEventTopic(p Publisher, tx *TransferTx) error {
+	return n.publishRouted(p, n.eventTopic(tx), n.brokerEventTopic(tx), tx, -1)
+}
+
+// eventTopic is the address topic of the event, PrefixTopic/<address>/<event>
+func (n *Notify) eventTopic(tx *TransferTx) string {
+	return fmt.Sprintf("%s%s/%s", n.p.PrefixTopic, strings.ToLower(tx.To.String()[2:]), tx.Event)
+}
+
+// brokerEventTopic is the address topic of the event on the broker by the topic template,
+// with the event in place of {confirmations}
+func (n *Notify) brokerEventTopic(tx *TransferTx) string {
+	if n.topicTemplate == nil {
+		return n.eventTopic(tx)
+	}
 
-	c.Publish(topic, n.p.QoS, false, string(payload))
+	v := n.topicValues(tx)
+	v.event = tx.Event
+	return n.topicTemplate.render(v)
+}
+
+// topicValues returns the values of the transaction to render the topic templates
+func (n *Notify) topicValues(tx *TransferTx) *topicValues {
+	v := &topicValues{
+		prefix:  n.p.PrefixTopic,
+		address: tx.To,
+		from:    tx.From,
+		to:      tx.To,
+		typ:     eventOf(tx),
+		chainID: n.p.ChainID,
+	}
+	if tx.To == nil {
+		v.address = &tx.From
+	}
+	return v
+}
+
+// AddSink adds the publisher which is published to in parallel with the Publisher
+func (n *Notify) AddSink(p Publisher) {
+	n.sinks = append(n.sinks, p)
+}
+
+// getPublisher returns the Publisher if set, or the publisher by the transport of
+// the publish config, behind the outbox and together with the sinks
+func (n *Notify) getPublisher() (Publisher, error) {
+	p := n.Publisher
+	if p == nil {
+		var err error
+		switch transportOf(n.p.Server) {
+		case transportMQTT:
+			if isMQTT5(n.p) {
+				willTopic, willPayload := n.statusWill()
+				p, err = newMQTT5Publisher(n.p, n.Logger, willTopic, willPayload, n.refreshStatus)
+			}
+		case transportNATS:
+			p, err = NewNATSPublisher(n.p)
+		case transportAMQP:
+			p, err = NewAMQPPublisher(n.p)
+		case transportSTOMP:
+			p, err = NewSTOMPPublisher(n.p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p == nil {
+		c, err := n.getPublishClient()
+		if err != nil {
+			return nil, err
+		}
+		p = NewMQTTPublisher(c)
+	}
+	o, err := newOutbox(p, n.p.Outbox, n.p.PublishTimeout, n.Logger)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	n.primary, n.outbox = p, o
+	go n.runStatus(n.primary)
+
+	if len(n.sinks) == 0 {
+		return o, nil
+	}
+	return &routePublisher{broker: o, sinks: NewMultiPublisher(n.sinks...)}, nil
 }
 
 func (n *Notify) getPublishClient() (mqtt.Client, error) {
+	tlsConfig, err := n.p.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
 	opts := mqtt.NewClientOptions().AddBroker(n.p.Server).SetClientID(n.p.ClientID)
 	opts.SetUsername(n.p.Username)
 	opts.SetPassword(n.p.Password)
+	opts.SetProtocolVersion(n.p.MQTTVersion)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	// the broker publishes the offline status once the connection is lost
+	if topic, payload := n.statusWill(); topic != "" {
+		opts.SetBinaryWill(topic, payload, n.p.QoS, true)
+	}
+	opts.OnConnect = func(mqtt.Client) {
+		n.refreshStatus()
+	}
 	c := mqtt.NewClient(opts)
 
 	go func() {
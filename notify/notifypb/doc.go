@@ -0,0 +1,5 @@
+// Package notifypb is the protobuf messages and the gRPC service of the streaming
+// notifications, generated from notify.proto.
+package notifypb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative notify/notifypb/notify.proto
@@ -0,0 +1,138 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.14.0
+// source: notify/notifypb/notify.proto
+
+package notifypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// NotifyClient is the client API for Notify service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type NotifyClient interface {
+	// Subscribe streams the events selected by the request till the client cancels,
+	// or fails with OUT_OF_RANGE if the events after the cursor are no longer kept,
+	// and with RESOURCE_EXHAUSTED if the client does not keep up.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Notify_SubscribeClient, error)
+}
+
+type notifyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNotifyClient(cc grpc.ClientConnInterface) NotifyClient {
+	return &notifyClient{cc}
+}
+
+func (c *notifyClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Notify_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Notify_ServiceDesc.Streams[0], "/newchain.notify.v1.Notify/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &notifySubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Notify_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type notifySubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *notifySubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NotifyServer is the server API for Notify service.
+// All implementations must embed UnimplementedNotifyServer
+// for forward compatibility
+type NotifyServer interface {
+	// Subscribe streams the events selected by the request till the client cancels,
+	// or fails with OUT_OF_RANGE if the events after the cursor are no longer kept,
+	// and with RESOURCE_EXHAUSTED if the client does not keep up.
+	Subscribe(*SubscribeRequest, Notify_SubscribeServer) error
+	mustEmbedUnimplementedNotifyServer()
+}
+
+// UnimplementedNotifyServer must be embedded to have forward compatible implementations.
+type UnimplementedNotifyServer struct {
+}
+
+func (UnimplementedNotifyServer) Subscribe(*SubscribeRequest, Notify_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedNotifyServer) mustEmbedUnimplementedNotifyServer() {}
+
+// UnsafeNotifyServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NotifyServer will
+// result in compilation errors.
+type UnsafeNotifyServer interface {
+	mustEmbedUnimplementedNotifyServer()
+}
+
+func RegisterNotifyServer(s grpc.ServiceRegistrar, srv NotifyServer) {
+	s.RegisterService(&Notify_ServiceDesc, srv)
+}
+
+func _Notify_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NotifyServer).Subscribe(m, &notifySubscribeServer{stream})
+}
+
+type Notify_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type notifySubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *notifySubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Notify_ServiceDesc is the grpc.ServiceDesc for Notify service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Notify_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "newchain.notify.v1.Notify",
+	HandlerType: (*NotifyServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Notify_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "notify/notifypb/notify.proto",
+}
@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/newtonproject/newchain-notify/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+// outboxMessage is the message failed to publish, kept in the outbox
+type outboxMessage struct {
+	Topic   string          `json:"topic"`
+	Payload []byte          `json:"payload"`
+	Opts    *PublishOptions `json:"opts,omitempty"`
+	Since   time.Time       `json:"since"`
+}
+
+// outboxCodec encodes outboxMessage for the durable queue
+type outboxCodec struct{}
+
+func (outboxCodec) Encode(data interface{}) ([]byte, error) {
+	msg, ok := data.(*outboxMessage)
+	if !ok {
+		return nil, errors.New("only outboxMessage can be encoded")
+	}
+	return json.Marshal(msg)
+}
+
+func (outboxCodec) Decode(b []byte) (interface{}, error) {
+	var msg outboxMessage
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// outbox publishes by the publisher, and keeps the messages failed to publish in
+// the durable queue, which are replayed in order once the publisher is back. The
+// messages published while the outbox is not empty are queued after them, so the
+// order of the messages is kept.
+type outbox struct {
+	p       Publisher
+	q       *queue.DurableQueue
+	timeout time.Duration
+	logger  *log.Logger
+	corrupt int // the messages failed to decode, moved aside by the queue
+
+	replaying chan struct{} // the token of the replay, only one at a time
+	kick      chan struct{}
+	quit      chan struct{}
+}
+
+// newOutbox opens the outbox in the path, in memory only if the path is empty,
+// and replays the messages restored in background.
+func newOutbox(p Publisher, path string, timeout time.Duration, logger *log.Logger) (*outbox, error) {
+	q, err := queue.OpenDurable(path, outboxCodec{})
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	o := &outbox{
+		p:         p,
+		q:         q,
+		timeout:   timeout,
+		logger:    logger,
+		replaying: make(chan struct{}, 1),
+		kick:      make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+	}
+	if size := q.Size(); size > 0 {
+		logger.Infof("Restored %d messages from outbox %s", size, path)
+		o.kick <- struct{}{}
+	}
+	go o.loop()
+
+	return o, nil
+}
+
+// Publish publishes the message if the outbox is empty, otherwise or if it fails,
+// the message is queued in the outbox. It returns nil once the message is either
+// confirmed or queued, and the error only if it can not be queued.
+func (o *outbox) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if o.q.Empty() {
+		err := o.p.Publish(ctx, topic, payload, opts)
+		if err == nil {
+			return nil
+		}
+		o.logger.WithFields(log.Fields{
+			"outbox": topic,
+		}).Warnln(err)
+	}
+
+	if err := o.q.Push(&outboxMessage{Topic: topic, Payload: payload, Opts: opts, Since: time.Now()}); err != nil {
+		return err
+	}
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Len returns the number of the messages waiting in the outbox
+func (o *outbox) Len() int {
+	return o.q.Size()
+}
+
+// Replay publishes the messages in the outbox in order, and returns the error of
+// the first message failed, which is kept at the front to replay next time.
+func (o *outbox) Replay() error {
+	o.replaying <- struct{}{}
+	defer func() { <-o.replaying }()
+
+	for {
+		front, err := o.q.Front()
+		if corrupt := o.q.Corrupted(); corrupt > o.corrupt {
+			o.logger.Warnf("moved aside %d messages of the outbox failed to decode", corrupt-o.corrupt)
+			o.corrupt = corrupt
+		}
+		if err == queue.ErrEmpty {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		msg := front.(*outboxMessage)
+
+		opts := msg.Opts
+		if opts != nil && opts.MessageExpiry > 0 {
+			// the expiry counts from when the message is queued
+			remaining := opts.MessageExpiry - time.Since(msg.Since)
+			if remaining <= 0 {
+				o.logger.WithFields(log.Fields{
+					"outbox": msg.Topic,
+				}).Warnln("message expired")
+				o.q.Pop()
+				continue
+			}
+			expiring := *opts
+			expiring.MessageExpiry = remaining
+			opts = &expiring
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+		err = o.p.Publish(ctx, msg.Topic, msg.Payload, opts)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if _, err := o.q.Pop(); err != nil {
+			return err
+		}
+	}
+}
+
+// loop replays the outbox with backoff once messages are queued
+func (o *outbox) loop() {
+	for {
+		select {
+		case <-o.kick:
+		case <-o.quit:
+			return
+		}
+
+		for backoff := minReconnectBackoff; ; {
+			err := o.Replay()
+			if err == nil {
+				break
+			}
+			o.logger.Warnf("Replay outbox of %d messages failed: %v", o.Len(), err)
+			select {
+			case <-time.After(backoff):
+			case <-o.quit:
+				return
+			}
+			if backoff *= 2; backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+		}
+	}
+}
+
+func (o *outbox) Close() error {
+	close(o.quit)
+	// wait for the replay in progress
+	o.replaying <- struct{}{}
+	err := o.p.Close()
+	if e := o.q.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// downPublisher fails to publish while it is down
+type downPublisher struct {
+	recordPublisher
+
+	lock sync.Mutex
+	down bool
+}
+
+func (p *downPublisher) setDown(down bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.down = down
+}
+
+func (p *downPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	p.lock.Lock()
+	down := p.down
+	p.lock.Unlock()
+
+	if down {
+		return errors.New("broker is down")
+	}
+	return p.recordPublisher.Publish(ctx, topic, payload, opts)
+}
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox")
+
+	pub := &downPublisher{down: true}
+	o, err := newOutbox(pub, path, time.Second, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"a", "b"} {
+		if err := o.Publish(context.Background(), topic, []byte("{}"), &PublishOptions{QoS: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if o.Len() != 2 {
+		t.Fatalf("outbox length mismatch: have %d, want %d", o.Len(), 2)
+	}
+	if o.Replay() == nil {
+		t.Fatal("replay succeeded while the broker is down")
+	}
+
+	// the messages published after are queued behind, and expired ones are dropped
+	pub.setDown(false)
+	if err := o.Publish(context.Background(), "c", []byte("{}"), &PublishOptions{MessageExpiry: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Publish(context.Background(), "d", []byte("{}"), &PublishOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "d"}
+	topics := pub.topics()
+	if len(topics) != len(want) {
+		t.Fatalf("replay mismatch: have %v, want %v", topics, want)
+	}
+	for i := range want {
+		if topics[i] != want[i] {
+			t.Errorf("topic mismatch: have %v, want %v", topics[i], want[i])
+		}
+	}
+	if pub.messages[0].opts.QoS != 1 {
+		t.Errorf("qos mismatch: have %v, want %v", pub.messages[0].opts.QoS, 1)
+	}
+
+	// the outbox is kept across restarts
+	pub.setDown(true)
+	if err := o.Publish(context.Background(), "e", []byte("{}"), &PublishOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pub = new(downPublisher)
+	o, err = newOutbox(pub, path, time.Second, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if err := o.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if topics := pub.topics(); len(topics) != 1 || topics[0] != "e" {
+		t.Errorf("restored mismatch: have %v, want %v", topics, []string{"e"})
+	}
+	if o.Len() != 0 {
+		t.Errorf("outbox length mismatch: have %d, want %d", o.Len(), 0)
+	}
+}
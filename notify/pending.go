@@ -4,9 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"unicode/utf8"
 
-	"github.com/eclipse/paho.mqtt.golang"
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -15,19 +14,36 @@ import (
 
 type PendingNotify struct {
 	Notify
+
+	rpcURL      string
+	nodePending *NodePendingConfig // nil for disable
+	seen        *hashSet
 }
 
-func NewPendingNotify(s, p *NotifyConfig, logger *log.Logger) (*PendingNotify, error) {
+func NewPendingNotify(s, p *NotifyConfig, rpcURL string, nodePending *NodePendingConfig, logger *log.Logger) (*PendingNotify, error) {
 	if s == nil || p == nil {
 		return nil, errors.New("subscribe or publish config can not be nil")
 	}
-	return &PendingNotify{
-		Notify{
+	if nodePending != nil && nodePending.Mode != NodePendingSubscribe && nodePending.Mode != NodePendingTxPool {
+		return nil, fmt.Errorf("node pending mode only %s or %s", NodePendingSubscribe, NodePendingTxPool)
+	}
+	n := &PendingNotify{
+		Notify: Notify{
 			s:      s,
 			p:      p,
 			Logger: logger,
 			quit:   make(chan struct{}, 1),
-		}}, nil
+			status: newServiceStatus(ServicePending, 0),
+		},
+		rpcURL:      rpcURL,
+		nodePending: nodePending,
+		seen:        newHashSet(defaultSeenSize),
+	}
+	if err := n.parseTopicTemplates(); err != nil {
+		return nil, err
+	}
+
+	return n, nil
 }
 
 // MarshalJSON encodes to json format.
@@ -35,14 +51,20 @@ func (n *PendingNotify) MarshalJSON() ([]byte, error) {
 	type config struct {
 		Subscribe   *NotifyConfig
 		Publish     *NotifyConfig
+		RPCURL      string             `json:",omitempty"`
+		NodePending *NodePendingConfig `json:",omitempty"`
 		LoggerLevel string
 	}
 
 	enc := &config{
 		Subscribe:   n.s,
 		Publish:     n.p,
+		NodePending: n.nodePending,
 		LoggerLevel: n.Logger.Level.String(),
 	}
+	if n.nodePending != nil {
+		enc.RPCURL = n.rpcURL
+	}
 
 	return json.Marshal(&enc)
 }
@@ -52,35 +74,53 @@ func (n *PendingNotify) Run() error {
 		n.Logger = log.New()
 	}
 
-	ch := make(chan string, 10)
-	onMessageReceived := func(c mqtt.Client, message mqtt.Message) {
-		if message != nil && message.Topic() == n.s.Topic {
-			ch <- string(message.Payload())
+	// the message is handled once the transactions are published
+	ch := make(chan received, 10)
+	onMessageReceived := func(topic string, payload []byte) error {
+		if topic != n.s.Topic {
+			return nil
 		}
+		done := make(chan error, 1)
+		ch <- received{payload: payload, done: done}
+		return <-done
 	}
 
 	if n.p.Topic == "" {
 		n.quit <- struct{}{}
 		return errors.New("publish topic set")
 	}
-	pClient, err := n.getPublishClient()
+	pub, err := n.getPublisher()
 	if err != nil {
 		n.quit <- struct{}{}
 		return err
 	}
-	if pClient == nil {
+	if pub == nil {
 		n.quit <- struct{}{}
-		return errors.New("publish client nil")
+		return errors.New("publisher nil")
+	}
+
+	txCh := make(chan *TransferTx, 10)
+	if n.nodePending != nil {
+		go n.runNodePending(txCh)
 	}
 
 	go func() {
 		for {
 			select {
-			case raw := <-ch:
+			case r := <-ch:
+				msg := string(r.payload)
+				if !utf8.Valid(r.payload) {
+					msg = hexutil.Encode(r.payload)
+				}
 				n.Logger.WithFields(log.Fields{
 					"subscribe": n.s.Topic,
-				}).Info(raw)
-				n.handlerRawTransaction(pClient, raw)
+				}).Info(msg)
+				r.done <- n.handlerRawTransaction(pub, r.payload)
+			case tx := <-txCh:
+				n.Logger.WithFields(log.Fields{
+					"node": n.nodePending.Mode,
+				}).Debug(tx.Hash.String())
+				n.publishPending(pub, tx)
 			case <-n.quit:
 				return
 			}
@@ -90,36 +130,48 @@ func (n *PendingNotify) Run() error {
 	return n.runSubscribeClient(onMessageReceived)
 }
 
-func (n *PendingNotify) handlerRawTransaction(c mqtt.Client, raw string) {
-	tx, err := decodeTransaction(raw)
+// handlerRawTransaction publishes the transactions of the message, and returns the
+// first error of publishing them. The message failed to decode is only logged, as it
+// can not be handled by delivering again.
+func (n *PendingNotify) handlerRawTransaction(p Publisher, raw []byte) error {
+	txs, err := decodeRawTransactions(raw, n.s.Format, n.Logger)
 	if err != nil {
 		n.Logger.Errorln(err)
-		return
-	}
-	if tx == nil {
-		n.Logger.Errorln(errors.New("tx is nil"))
-		return
-	}
-	signer := types.NewEIP155Signer(tx.ChainId())
-	from, err := signer.Sender(tx)
-	if err != nil {
-		n.Logger.Errorln(err)
-		return
-	}
-	if from == (common.Address{}) {
-		n.Logger.Errorln(errors.New("from address is nil"))
-		return
+		return nil
+	}
+	var failed error
+	for _, rawTx := range txs {
+		aTx, err := newPendingTransferTx(rawTx.tx)
+		if err != nil {
+			n.Logger.Errorln(err)
+			continue
+		}
+		aTx.Meta = rawTx.meta
+
+		if err := n.publishPending(p, aTx); err != nil && failed == nil {
+			failed = err
+		}
 	}
+	return failed
+}
 
-	aTx := &TransferTx{
-		From:  from,
-		To:    tx.To(),
-		Value: tx.Value(),
-		Hash:  tx.Hash(),
+// publishPending publish the transaction only once whether it from MQTT or the node,
+// the transaction is not seen until it is published to both topics
+func (n *PendingNotify) publishPending(p Publisher, tx *TransferTx) error {
+	if n.seen.Has(tx.Hash) {
+		n.Logger.Debugln("skip seen transaction", tx.Hash.String())
+		return nil
 	}
 
-	n.publish(c, aTx)
-	n.publishToBlockTopic(c, aTx, 0)
+	err := n.publish(p, tx)
+	if berr := n.publishToBlockTopic(p, tx, 0); err == nil {
+		err = berr
+	}
+	if err != nil {
+		return err
+	}
+	n.seen.Add(tx.Hash)
+	return nil
 }
 
 func decodeTransaction(hexParam string) (*types.Transaction, error) {
@@ -0,0 +1,258 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PublishOptions is the delivery options of a message
+type PublishOptions struct {
+	QoS      byte
+	Retained bool
+
+	// the message properties, only carried by the transports supporting them such as MQTT 5
+	ContentType     string
+	CorrelationData []byte
+	UserProperties  []UserProperty
+	MessageExpiry   time.Duration // 0 for never expired
+}
+
+// UserProperty is the key value pair of the user properties of a message
+type UserProperty struct {
+	Key, Value string
+}
+
+// Publisher is the transport the services publish the transactions to
+type Publisher interface {
+	// Publish publishes the payload to the topic, and returns once the delivery
+	// is confirmed by the transport according to the options, or the context is done.
+	Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error
+
+	// Close closes the connection of the transport.
+	Close() error
+}
+
+// defaultPublishTimeout is the timeout of each publish if the caller sets none
+const defaultPublishTimeout = 10 * time.Second
+
+// mqttPublisher publishes by the paho MQTT client
+type mqttPublisher struct {
+	c mqtt.Client
+}
+
+// NewMQTTPublisher creates the publisher by the connected or connecting MQTT client
+func NewMQTTPublisher(c mqtt.Client) Publisher {
+	return &mqttPublisher{c: c}
+}
+
+// Publish waits for the token of the message, which is completed once it is sent
+// for QoS 0, or acknowledged by the broker for QoS 1 and 2. It waits up to 10s if
+// the context has no deadline, so a broker never acknowledging can not block the caller.
+func (p *mqttPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultPublishTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	token := p.c.Publish(topic, opts.QoS, opts.Retained, payload)
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- token.WaitTimeout(time.Until(deadline))
+	}()
+	select {
+	case ok := <-done:
+		if !ok {
+			return context.DeadlineExceeded
+		}
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *mqttPublisher) Close() error {
+	p.c.Disconnect(250)
+	return nil
+}
+
+// matchTopic checks whether the topic matches the MQTT topic filter
+func matchTopic(filter, topic string) bool {
+	filters := strings.Split(filter, "/")
+	levels := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) {
+			return false
+		}
+		if f != "+" && f != levels[i] {
+			return false
+		}
+	}
+
+	return len(filters) == len(levels)
+}
+
+// dotTopic maps the MQTT topic to the dot separated one, with the MQTT wildcards
+// + and # to the single and multiple level ones
+func dotTopic(topic, single, multi string) string {
+	levels := strings.Split(strings.Trim(topic, "/"), "/")
+	for i, level := range levels {
+		switch level {
+		case "+":
+			levels[i] = single
+		case "#":
+			levels[i] = multi
+		}
+	}
+	return strings.Join(levels, ".")
+}
+
+var addressLevel = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// notificationAddress returns the checksummed address the notification is about.
+// For the address topic PrefixTopic/<address>/<confirmations>, it is the address
+// of the topic, together with the level after it, otherwise it is the receiver,
+// or the sender if none, of the transaction in the payload.
+func notificationAddress(prefix, topic string, payload []byte) (string, string) {
+	if prefix != "" && strings.HasPrefix(topic, prefix) {
+		levels := strings.Split(topic[len(prefix):], "/")
+		if len(levels) == 2 && addressLevel.MatchString(levels[0]) {
+			return common.HexToAddress(levels[0]).Hex(), levels[1]
+		}
+	}
+
+	var tx struct {
+		From *common.Address `json:"from"`
+		To   *common.Address `json:"to"`
+	}
+	if err := json.Unmarshal(payload, &tx); err == nil {
+		if tx.To != nil {
+			return tx.To.Hex(), ""
+		} else if tx.From != nil {
+			return tx.From.Hex(), ""
+		}
+	}
+
+	return "", ""
+}
+
+// multiPublisher publishes to all the publishers in parallel
+type multiPublisher []Publisher
+
+// NewMultiPublisher creates the publisher which publishes to all the publishers in
+// parallel, and returns the first error if any of them fails.
+func NewMultiPublisher(publishers ...Publisher) Publisher {
+	if len(publishers) == 1 {
+		return publishers[0]
+	}
+	return multiPublisher(publishers)
+}
+
+func (m multiPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+	for i, p := range m {
+		wg.Add(1)
+		go func(i int, p Publisher) {
+			defer wg.Done()
+			errs[i] = p.Publish(ctx, topic, payload, opts)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiPublisher) Close() error {
+	var err error
+	for _, p := range m {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// routePublisher publishes to the broker and the sinks in parallel, where the
+// broker may have the topic by the topic template, while the sinks always have
+// the default layout, which they parse for the address and the confirmations.
+type routePublisher struct {
+	broker Publisher
+	sinks  Publisher
+}
+
+func (r *routePublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	return r.publishRouted(ctx, topic, topic, payload, opts)
+}
+
+func (r *routePublisher) publishRouted(ctx context.Context, brokerTopic, topic string, payload []byte, opts *PublishOptions) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.sinks.Publish(ctx, topic, payload, opts)
+	}()
+	err := r.broker.Publish(ctx, brokerTopic, payload, opts)
+	if e := <-errs; err == nil {
+		err = e
+	}
+	return err
+}
+
+func (r *routePublisher) Close() error {
+	err := r.broker.Close()
+	if e := r.sinks.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// redial gates the connecting again of the publishers after the connection is
+// lost, so that the publishing fails fast within the backoff instead of dialing
+// for every message. It is not safe for concurrent use.
+type redial struct {
+	backoff time.Duration
+	next    time.Time
+}
+
+func newRedial() *redial {
+	return &redial{backoff: minReconnectBackoff}
+}
+
+// allow returns the error if it is still within the backoff of the last failure
+func (r *redial) allow() error {
+	if wait := time.Until(r.next); wait > 0 {
+		return fmt.Errorf("connection lost, reconnect in %v", wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (r *redial) failed() {
+	r.next = time.Now().Add(r.backoff)
+	if r.backoff *= 2; r.backoff > maxReconnectBackoff {
+		r.backoff = maxReconnectBackoff
+	}
+}
+
+func (r *redial) succeeded() {
+	r.backoff = minReconnectBackoff
+	r.next = time.Time{}
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	log "github.com/sirupsen/logrus"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+	opts    PublishOptions
+}
+
+// recordPublisher records the published messages
+type recordPublisher struct {
+	lock     sync.Mutex
+	messages []message
+}
+
+func (p *recordPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.messages = append(p.messages, message{topic: topic, payload: payload, opts: *opts})
+	return nil
+}
+
+func (p *recordPublisher) Close() error {
+	return nil
+}
+
+func (p *recordPublisher) topics() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	topics := make([]string, len(p.messages))
+	for i, m := range p.messages {
+		topics[i] = m.topic
+	}
+	return topics
+}
+
+func TestPublishPending(t *testing.T) {
+	s := &NotifyConfig{Topic: "Pending"}
+	p := &NotifyConfig{Topic: "Transfer", PrefixTopic: "NewChain/", QoS: 1}
+	n, err := NewPendingNotify(s, p, "", nil, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := new(recordPublisher)
+
+	txs := newSignedTransactions(t, 1)
+	tx, err := newPendingTransferTx(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.publishPending(pub, tx)
+	n.publishPending(pub, tx)
+
+	want := []string{"Transfer", "NewChain/97549e368acafdcae786bb93d98379f1d1561a29/0"}
+	topics := pub.topics()
+	if len(topics) != len(want) {
+		t.Fatalf("publish count mismatch: have %v, want %v", topics, want)
+	}
+	for i := range want {
+		if topics[i] != want[i] {
+			t.Errorf("topic mismatch: have %v, want %v", topics[i], want[i])
+		}
+	}
+	if pub.messages[0].opts.QoS != 1 {
+		t.Errorf("qos mismatch: have %v, want %v", pub.messages[0].opts.QoS, 1)
+	}
+}
+
+// failPublisher fails the first publishes and then records the others
+type failPublisher struct {
+	recordPublisher
+	failures int
+}
+
+func (p *failPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("publish failed")
+	}
+	return p.recordPublisher.Publish(ctx, topic, payload, opts)
+}
+
+func TestPublishPendingFailed(t *testing.T) {
+	s := &NotifyConfig{Topic: "Pending"}
+	p := &NotifyConfig{Topic: "Transfer", PrefixTopic: "NewChain/"}
+	n, err := NewPendingNotify(s, p, "", nil, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := &failPublisher{failures: 1}
+
+	txs := newSignedTransactions(t, 1)
+	raw, err := rlp.EncodeToBytes(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(hexutil.Encode(raw))
+
+	// the failed message is not seen, so it is published once delivered again
+	if err := n.handlerRawTransaction(pub, payload); err == nil {
+		t.Fatal("handle mismatch: have nil, want the publish error")
+	}
+	if err := n.handlerRawTransaction(pub, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.handlerRawTransaction(pub, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"NewChain/97549e368acafdcae786bb93d98379f1d1561a29/0", "Transfer", "NewChain/97549e368acafdcae786bb93d98379f1d1561a29/0"}
+	topics := pub.topics()
+	if len(topics) != len(want) {
+		t.Fatalf("publish count mismatch: have %v, want %v", topics, want)
+	}
+	for i := range want {
+		if topics[i] != want[i] {
+			t.Errorf("topic mismatch: have %v, want %v", topics[i], want[i])
+		}
+	}
+}
+
+func TestRetryHandle(t *testing.T) {
+	n := &Notify{s: &NotifyConfig{}, Logger: log.New()}
+	attempts := 0
+	n.retryHandle(func(topic string, payload []byte) error {
+		if attempts++; attempts < 2 {
+			return errors.New("publish failed")
+		}
+		return nil
+	}, "test", nil)
+	if attempts != 2 {
+		t.Errorf("attempts mismatch: have %d, want %d", attempts, 2)
+	}
+}
+
+// unackedToken is the token of a message never acknowledged by the broker
+type unackedToken struct{}
+
+func (unackedToken) Wait() bool {
+	select {}
+}
+
+func (unackedToken) WaitTimeout(d time.Duration) bool {
+	time.Sleep(d)
+	return false
+}
+
+func (unackedToken) Error() error {
+	return nil
+}
+
+// unackedClient is the MQTT client of a broker never acknowledging
+type unackedClient struct {
+	mqtt.Client
+}
+
+func (unackedClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	return unackedToken{}
+}
+
+func TestMQTTPublishTimeout(t *testing.T) {
+	p := NewMQTTPublisher(unackedClient{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Publish(ctx, "newchain/Pending", []byte("{}"), &PublishOptions{QoS: 1}); err != context.DeadlineExceeded {
+		t.Errorf("publish error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publish blocked for %v", elapsed)
+	}
+}
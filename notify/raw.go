@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RawFormatAuto detects the format of the raw transaction message automatically
+	RawFormatAuto = "auto"
+	// RawFormatHex is one hex-encoded RLP transaction, such as 0xf86b...
+	RawFormatHex = "hex"
+	// RawFormatJSON is a hex string, an envelope such as {"raw": "0x..", "source": ".."},
+	// or an array of hex strings and envelopes
+	RawFormatJSON = "json"
+	// RawFormatBinary is the binary RLP of one transaction or a list of transactions
+	RawFormatBinary = "binary"
+)
+
+// RawFormats is the list of the supported raw transaction message format
+var RawFormats = []string{RawFormatAuto, RawFormatHex, RawFormatJSON, RawFormatBinary}
+
+// rawTransaction is the transaction decoded from the RawTransaction message
+type rawTransaction struct {
+	tx   *types.Transaction
+	meta map[string]json.RawMessage // the envelope fields except raw
+}
+
+// decodeRawTransactions decodes the transactions of the message in the format, the
+// invalid items of a JSON array are skipped with a warning by the logger
+func decodeRawTransactions(payload []byte, format string, logger log.FieldLogger) ([]*rawTransaction, error) {
+	if format == "" || format == RawFormatAuto {
+		format = detectRawFormat(payload)
+	}
+
+	switch format {
+	case RawFormatHex:
+		tx, err := decodeTransaction(string(bytes.TrimSpace(payload)))
+		if err != nil {
+			return nil, err
+		}
+		return []*rawTransaction{{tx: tx}}, nil
+	case RawFormatJSON:
+		return decodeJSONTransactions(payload, logger)
+	case RawFormatBinary:
+		return decodeBinaryTransactions(payload)
+	}
+
+	return nil, fmt.Errorf("unknown raw transaction format %s", format)
+}
+
+func detectRawFormat(payload []byte) string {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		return RawFormatHex
+	}
+	switch payload[0] {
+	case '{', '[', '"':
+		return RawFormatJSON
+	}
+	if bytes.HasPrefix(payload, []byte("0x")) || bytes.HasPrefix(payload, []byte("0X")) {
+		return RawFormatHex
+	}
+
+	return RawFormatBinary
+}
+
+func decodeJSONTransactions(payload []byte, logger log.FieldLogger) ([]*rawTransaction, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '[' {
+		rawTx, err := decodeJSONTransaction(payload)
+		if err != nil {
+			return nil, err
+		}
+		return []*rawTransaction{rawTx}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(payload, &items); err != nil {
+		return nil, err
+	}
+	txs := make([]*rawTransaction, 0, len(items))
+	for i, item := range items {
+		rawTx, err := decodeJSONTransaction(item)
+		if err != nil {
+			logger.Warnf("skip the transaction %d of the array: %v", i, err)
+			continue
+		}
+		txs = append(txs, rawTx)
+	}
+
+	return txs, nil
+}
+
+func decodeJSONTransaction(item json.RawMessage) (*rawTransaction, error) {
+	item = bytes.TrimSpace(item)
+	if len(item) > 0 && item[0] == '"' {
+		var raw string
+		if err := json.Unmarshal(item, &raw); err != nil {
+			return nil, err
+		}
+		tx, err := decodeTransaction(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &rawTransaction{tx: tx}, nil
+	}
+
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(item, &meta); err != nil {
+		return nil, err
+	}
+	var raw string
+	if err := json.Unmarshal(meta["raw"], &raw); err != nil {
+		return nil, errors.New("envelope raw must be hex string")
+	}
+	delete(meta, "raw")
+	if len(meta) == 0 {
+		meta = nil
+	}
+
+	tx, err := decodeTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawTransaction{tx: tx, meta: meta}, nil
+}
+
+func decodeBinaryTransactions(payload []byte) ([]*rawTransaction, error) {
+	if len(payload) <= 0 {
+		return nil, fmt.Errorf("decode transaction error")
+	}
+
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(payload, tx); err == nil {
+		return []*rawTransaction{{tx: tx}}, nil
+	}
+
+	var list types.Transactions
+	if err := rlp.DecodeBytes(payload, &list); err != nil {
+		return nil, err
+	}
+	txs := make([]*rawTransaction, 0, len(list))
+	for _, tx := range list {
+		txs = append(txs, &rawTransaction{tx: tx})
+	}
+
+	return txs, nil
+}
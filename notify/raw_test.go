@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func newSignedTransactions(t *testing.T, count int) types.Transactions {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1007))
+	to := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+
+	var txs types.Transactions
+	for i := 0; i < count; i++ {
+		tx := types.NewTransaction(uint64(i), to, big.NewInt(1), 21000, big.NewInt(1), nil)
+		tx, err = types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+func encodeHex(t *testing.T, tx *types.Transaction) string {
+	b, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexutil.Encode(b)
+}
+
+func TestDecodeRawTransactions(t *testing.T) {
+	txs := newSignedTransactions(t, 2)
+	raw0, raw1 := encodeHex(t, txs[0]), encodeHex(t, txs[1])
+	binary0, err := rlp.EncodeToBytes(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryList, err := rlp.EncodeToBytes(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		format  string
+		want    int
+		meta    string
+	}{
+		{"hex", []byte(raw0), RawFormatHex, 1, ""},
+		{"auto hex", []byte(" " + raw0 + "\n"), RawFormatAuto, 1, ""},
+		{"json string", []byte(fmt.Sprintf("%q", raw0)), RawFormatJSON, 1, ""},
+		{"json array", []byte(fmt.Sprintf("[%q, %q]", raw0, raw1)), RawFormatAuto, 2, ""},
+		{"json envelope", []byte(fmt.Sprintf(`{"raw": %q, "source": "gateway"}`, raw0)), RawFormatAuto, 1, `"gateway"`},
+		{"json envelope array", []byte(fmt.Sprintf(`[{"raw": %q, "source": "gateway"}, %q]`, raw0, raw1)), "", 2, `"gateway"`},
+		{"binary", binary0, RawFormatAuto, 1, ""},
+		{"binary list", binaryList, RawFormatBinary, 2, ""},
+	}
+
+	for _, test := range tests {
+		got, err := decodeRawTransactions(test.payload, test.format, log.New())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(got) != test.want {
+			t.Errorf("%s: size mismatch: have %d, want %d", test.name, len(got), test.want)
+			continue
+		}
+		for i, rawTx := range got {
+			if rawTx.tx.Hash() != txs[i].Hash() {
+				t.Errorf("%s: hash mismatch: have %s, want %s", test.name, rawTx.tx.Hash().String(), txs[i].Hash().String())
+			}
+		}
+		if test.meta != "" && string(got[0].meta["source"]) != test.meta {
+			t.Errorf("%s: meta mismatch: have %s, want %s", test.name, got[0].meta["source"], test.meta)
+		}
+	}
+
+	if _, err := decodeRawTransactions([]byte(`{"source": "gateway"}`), RawFormatJSON, log.New()); err == nil {
+		t.Errorf("envelope without raw should fail")
+	}
+}
+
+func TestDecodeMixedJSONArray(t *testing.T) {
+	txs := newSignedTransactions(t, 2)
+	payload := fmt.Sprintf(`[%q, "0xinvalid", {"source": "gateway"}, {"raw": %q, "source": "gateway"}, 1]`,
+		encodeHex(t, txs[0]), encodeHex(t, txs[1]))
+
+	logger, hook := logtest.NewNullLogger()
+	got, err := decodeRawTransactions([]byte(payload), RawFormatAuto, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(txs) {
+		t.Fatalf("size mismatch: have %d, want %d", len(got), len(txs))
+	}
+	for i, rawTx := range got {
+		if rawTx.tx.Hash() != txs[i].Hash() {
+			t.Errorf("hash mismatch: have %s, want %s", rawTx.tx.Hash().String(), txs[i].Hash().String())
+		}
+	}
+	if skipped := len(hook.AllEntries()); skipped != 3 {
+		t.Errorf("skipped mismatch: have %d, want %d", skipped, 3)
+	}
+}
+
+func TestTransferTxMeta(t *testing.T) {
+	txs := newSignedTransactions(t, 1)
+	got, err := decodeRawTransactions([]byte(fmt.Sprintf(`{"raw": %q, "source": "gateway"}`, encodeHex(t, txs[0]))), RawFormatAuto, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	aTx, err := newPendingTransferTx(got[0].tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aTx.Meta = got[0].meta
+
+	payload, err := json.Marshal(aTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeTransferTx(string(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != aTx.Hash || string(decoded.Meta["source"]) != `"gateway"` {
+		t.Errorf("transfer tx mismatch: have %s, want %s", decoded.Hash.String(), aTx.Hash.String())
+	}
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// ConfirmBlock confirms the transaction if it in the latest blocks seen by the transfer
+	ConfirmBlock = "block"
+	// ConfirmReceipt confirms the transaction by eth_getTransactionReceipt and the current head number
+	ConfirmReceipt = "receipt"
+)
+
+// ConfirmModes is the list of the supported confirm mode
+var ConfirmModes = []string{ConfirmBlock, ConfirmReceipt}
+
+// inclusion is the block which includes the transaction
+type inclusion struct {
+	number *big.Int
+	hash   common.Hash
+	status *uint64 // only for receipt confirm mode
+	deep   bool    // whether the block is enough blocks behind the head to be confirmed
+}
+
+// txReceipt is the fields of eth_getTransactionReceipt used by the transfer
+type txReceipt struct {
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber *hexutil.Big   `json:"blockNumber"`
+	Status      hexutil.Uint64 `json:"status"`
+}
+
+// getReceipts gets the current head number and the receipts of the hashes in one batch,
+// the receipt is nil if the transaction is not mined yet. The error of each receipt is
+// in errs, so that one failing receipt does not fail the others.
+func getReceipts(ctx context.Context, c *rpc.Client, hashes []common.Hash) (head *big.Int, receipts []*txReceipt, errs []error, err error) {
+	var number hexutil.Big
+	receipts = make([]*txReceipt, len(hashes))
+	errs = make([]error, len(hashes))
+
+	batch := make([]rpc.BatchElem, 0, len(hashes)+1)
+	batch = append(batch, rpc.BatchElem{
+		Method: "eth_blockNumber",
+		Result: &number,
+	})
+	for i, hash := range hashes {
+		batch = append(batch, rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{hash},
+			Result: &receipts[i],
+		})
+	}
+
+	if err := c.BatchCallContext(ctx, batch); err != nil {
+		return nil, nil, nil, err
+	}
+	if batch[0].Error != nil {
+		return nil, nil, nil, batch[0].Error
+	}
+	for i, elem := range batch[1:] {
+		if elem.Error != nil {
+			receipts[i], errs[i] = nil, elem.Error
+		}
+	}
+
+	return number.ToInt(), receipts, errs, nil
+}
+
+// getCanonicalHashes gets the hashes of the canonical blocks by the numbers in one batch.
+// The blocks failed to get or not found are missing, as unknown yet, never as reorged.
+func getCanonicalHashes(ctx context.Context, c *rpc.Client, numbers []*big.Int) (map[uint64]common.Hash, error) {
+	type header struct {
+		Hash common.Hash `json:"hash"`
+	}
+
+	hashes := make(map[uint64]common.Hash)
+	keys := make([]uint64, 0, len(numbers))
+	headers := make([]*header, len(numbers))
+	batch := make([]rpc.BatchElem, 0, len(numbers))
+	seen := make(map[uint64]bool)
+	for _, number := range numbers {
+		key := number.Uint64()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		batch = append(batch, rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeBig(number), false},
+			Result: &headers[len(keys)],
+		})
+		keys = append(keys, key)
+	}
+
+	if err := c.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+	for i, elem := range batch {
+		if elem.Error == nil && headers[i] != nil && headers[i].Hash != (common.Hash{}) {
+			hashes[keys[i]] = headers[i].Hash
+		}
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	defaultRedisKeyPrefix = "notify:"
+	defaultRedisTimeout   = 10 * time.Second
+)
+
+// RedisConfig is the config of the Redis Streams publisher
+type RedisConfig struct {
+	Addr        string // host:port, or the redis:// or rediss:// URL
+	Username    string
+	Password    string
+	DB          int
+	Stream      string // the single stream to add to, empty for the streams per address
+	KeyPrefix   string // the prefix of the streams per address, default notify:
+	MaxLen      int64  // the approximate max length of the streams, 0 for unlimited
+	Timeout     time.Duration
+	PrefixTopic string // the PrefixTopic of the publish config, to map the address topics
+}
+
+// redisPublisher adds the notifications to the Redis Streams by XADD, with the
+// fields topic, address and payload. The notifications of an address are added
+// to the stream KeyPrefix<address>, with the lowercase address without 0x as the
+// address topics, or all to the single Stream if set.
+//
+// The address is the one of the address topic PrefixTopic/<address>/<confirmations>,
+// otherwise the receiver, or the sender if none, of the transaction.
+type redisPublisher struct {
+	pool *redis.Pool
+	c    *RedisConfig
+}
+
+// NewRedisPublisher connects to the Redis server
+func NewRedisPublisher(c *RedisConfig) (Publisher, error) {
+	if c == nil || c.Addr == "" {
+		return nil, errors.New("redis addr can not be empty")
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = defaultRedisKeyPrefix
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultRedisTimeout
+	}
+
+	p := &redisPublisher{c: c}
+	p.pool = &redis.Pool{
+		Dial:        p.dial,
+		MaxIdle:     4,
+		IdleTimeout: 5 * time.Minute,
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+
+	conn := p.pool.Get()
+	defer conn.Close()
+	if _, err := redis.DoWithTimeout(conn, c.Timeout, "PING"); err != nil {
+		p.pool.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *redisPublisher) dial() (redis.Conn, error) {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(p.c.Timeout),
+		redis.DialReadTimeout(p.c.Timeout),
+		redis.DialWriteTimeout(p.c.Timeout),
+	}
+	if p.c.Username != "" {
+		opts = append(opts, redis.DialUsername(p.c.Username))
+	}
+	if p.c.Password != "" {
+		opts = append(opts, redis.DialPassword(p.c.Password))
+	}
+	if strings.HasPrefix(p.c.Addr, "redis://") || strings.HasPrefix(p.c.Addr, "rediss://") {
+		return redis.DialURL(p.c.Addr, opts...)
+	}
+
+	return redis.Dial("tcp", p.c.Addr, append(opts, redis.DialDatabase(p.c.DB))...)
+}
+
+// stream returns the stream and the address of the notification
+func (p *redisPublisher) stream(topic string, payload []byte) (string, string) {
+	address, _ := notificationAddress(p.c.PrefixTopic, topic, payload)
+	if p.c.Stream != "" {
+		return p.c.Stream, address
+	}
+	if address == "" {
+		return p.c.KeyPrefix + topic, address
+	}
+
+	return p.c.KeyPrefix + strings.ToLower(address[2:]), address
+}
+
+// Publish returns once the notification is added to the stream
+func (p *redisPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	timeout := p.c.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+	}
+
+	stream, address := p.stream(topic, payload)
+	args := redis.Args{stream}
+	if p.c.MaxLen > 0 {
+		args = args.Add("MAXLEN", "~", p.c.MaxLen)
+	}
+	args = args.Add("*", "topic", topic, "address", address, "payload", payload)
+	_, err = redis.DoWithTimeout(conn, timeout, "XADD", args...)
+
+	return err
+}
+
+func (p *redisPublisher) Close() error {
+	return p.pool.Close()
+}
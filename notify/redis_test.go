@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisPublisher(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const address = "97549e368acafdcae786bb93d98379f1d1561a29"
+	payload := []byte(`{"from":"0x0000000000000000000000000000000000000001","to":"0x` + address + `"}`)
+
+	p, err := NewRedisPublisher(&RedisConfig{Addr: s.Addr(), MaxLen: 2, PrefixTopic: "newchain/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 3; i++ {
+		if err := p.Publish(context.Background(), fmt.Sprintf("newchain/%s/%d", address, i), payload, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// keyed by the receiver of the payload
+	if err := p.Publish(context.Background(), "Transfer4", payload, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.Stream(defaultRedisKeyPrefix + address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entry count mismatch: have %v, want %v", len(entries), 2)
+	}
+	want := []string{"topic", "newchain/" + address + "/2", "address", "0x97549E368AcaFdCAE786BB93D98379f1D1561a29", "payload", string(payload)}
+	if fmt.Sprint(entries[0].Values) != fmt.Sprint(want) {
+		t.Errorf("entry mismatch: have %v, want %v", entries[0].Values, want)
+	}
+
+	single, err := NewRedisPublisher(&RedisConfig{Addr: s.Addr(), Stream: "notifications"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+	if err := single.Publish(context.Background(), "Transfer4", payload, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries[1].Values[1] != "Transfer4" {
+		t.Errorf("topic mismatch: have %v, want %v", entries[1].Values[1], "Transfer4")
+	}
+
+	if entries, err := s.Stream("notifications"); err != nil || len(entries) != 1 {
+		t.Errorf("single stream mismatch: have %v %v, want 1 entry", entries, err)
+	}
+}
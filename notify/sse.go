@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/address"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ssePath      = "/v1/addresses/"
+	sseKeepAlive = 15 * time.Second
+)
+
+// SSEConfig is the config of the Server-Sent Events server
+type SSEConfig struct {
+	Addr    string
+	Origins []string // the origins allowed by CORS, * for any, Default none
+}
+
+type sseHandler struct {
+	hub     *Hub
+	origins []string
+}
+
+// NewSSEHandler returns the handler of GET /v1/addresses/{address}/events, which
+// streams the events of the address on the hub as text/event-stream.
+//
+// The query confirmations is the min confirmations of the confirmed events, and
+// pending=true includes the pending events. Each event is sent with the id of its
+// cursor, the event of its type, and the data of the Event JSON, so a reconnecting
+// client resumes after the header Last-Event-ID, or the query lastEventId, within
+// the history of the hub.
+func NewSSEHandler(hub *Hub, origins []string) http.Handler {
+	return &sseHandler{hub: hub, origins: origins}
+}
+
+func (h *sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := h.allowOrigin(r.Header.Get("Origin")); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	levels := strings.Split(strings.TrimPrefix(r.URL.Path, ssePath), "/")
+	if !strings.HasPrefix(r.URL.Path, ssePath) || len(levels) != 2 || levels[1] != "events" {
+		http.NotFound(w, r)
+		return
+	}
+	addr, err := address.Parse(levels[0])
+	if err != nil {
+		http.Error(w, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := SubscribeFilter{
+		Addresses:      []common.Address{addr},
+		IncludePending: query.Get("pending") == "true",
+	}
+	if s := query.Get("confirmations"); s != "" {
+		confirmations, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid confirmations", http.StatusBadRequest)
+			return
+		}
+		filter.Confirmations = confirmations
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+	if lastEventID != "" {
+		cursor, err := ParseCursor(lastEventID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.After = &cursor
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub, err := h.hub.Subscribe(filter)
+	switch err {
+	case nil:
+	case ErrCursorExpired:
+		// the client has to start over without the Last-Event-ID
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				// the client reconnects and resumes by the Last-Event-ID
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.Cursor, e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin of the origin, empty if not allowed
+func (h *sseHandler) allowOrigin(origin string) string {
+	for _, allowed := range h.origins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// ServeSSE listens on the address of the config, and serves the Server-Sent Events
+// server in background
+func ServeSSE(c *SSEConfig, hub *Hub, logger *log.Logger) (*http.Server, error) {
+	l, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{Handler: NewSSEHandler(hub, c.Origins)}
+	go func() {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorln(err)
+		}
+	}()
+	logger.Infof("SSE server listening on %s", l.Addr())
+
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/address"
+)
+
+// readSSE reads the fields of the next event, skipping the comments
+func readSSE(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		fields[line[:i]] = line[i+2:]
+	}
+}
+
+func TestSSE(t *testing.T) {
+	hub := NewHub("newchain/", 0)
+	s := httptest.NewServer(NewSSEHandler(hub, []string{"*"}))
+	defer s.Close()
+
+	topic := "newchain/" + hubTo[2:]
+	hubPublish(t, hub, topic+"/0", hubPayload(common.BytesToHash([]byte{1}).Hex(), -1))
+	hubPublish(t, hub, topic+"/4", hubPayload(common.BytesToHash([]byte{1}).Hex(), 1))
+	hubPublish(t, hub, topic+"/4", hubPayload(common.BytesToHash([]byte{2}).Hex(), 2))
+
+	url := s.URL + "/v1/addresses/" + address.ToNEW(common.HexToAddress(hubFrom), 1012) + "/events?confirmations=4"
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response mismatch: %v %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if e := readSSE(t, r); e["id"] != "2-0" || e["event"] != EventConfirmed {
+		t.Errorf("replay mismatch: %v", e)
+	}
+	hubPublish(t, hub, topic+"/4", hubPayload(common.BytesToHash([]byte{3}).Hex(), 3))
+	if e := readSSE(t, r); e["id"] != "3-0" || !strings.Contains(e["data"], `"cursor":"3-0"`) {
+		t.Errorf("event mismatch: %v", e)
+	}
+
+	for path, code := range map[string]int{
+		"/v1/addresses/0xinvalid/events":                       http.StatusBadRequest,
+		"/v1/addresses/NEWinvalid/events":                      http.StatusBadRequest,
+		"/v1/addresses/" + hubFrom:                             http.StatusNotFound,
+		"/v1/addresses/" + hubFrom + "/events?confirmations=x": http.StatusBadRequest,
+	} {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("status of %s mismatch: have %v, want %v", path, resp.StatusCode, code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+
+	ServicePending  = "pending"
+	ServiceTransfer = "transfer"
+	ServiceMonitor  = "monitor"
+
+	defaultStatusInterval = 30 * time.Second
+)
+
+// Status is the status document of the service, published retained to the status
+// topic on connect and refreshed periodically, and as the last will once offline
+type Status struct {
+	Service     string    `json:"service"`
+	Status      string    `json:"status"` // online or offline
+	Version     string    `json:"version,omitempty"`
+	Delay       int64     `json:"delay"`
+	BlockHeight *uint64   `json:"blockHeight,omitempty"` // the last block handled
+	LatestBlock *uint64   `json:"latestBlock,omitempty"` // the latest block of the node
+	Lag         *int64    `json:"lag,omitempty"`         // the blocks the last handled is behind the latest besides the delay
+	Time        time.Time `json:"time"`
+}
+
+// serviceStatus keeps the status of the service to publish
+type serviceStatus struct {
+	lock        sync.Mutex
+	service     string
+	delay       int64
+	blockHeight *uint64
+	ec          *ethclient.Client // the client to get the latest block
+
+	kick chan struct{} // publish the status now, such as connected again
+}
+
+func newServiceStatus(service string, delay int64) *serviceStatus {
+	return &serviceStatus{service: service, delay: delay, kick: make(chan struct{}, 1)}
+}
+
+// setBlockHeight records the last block handled by the service
+func (s *serviceStatus) setBlockHeight(number uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.blockHeight = &number
+}
+
+// latestBlock returns the latest block by the client, nil if unknown
+func (s *serviceStatus) latestBlock(ctx context.Context) (*uint64, error) {
+	s.lock.Lock()
+	ec := s.ec
+	s.lock.Unlock()
+	if ec == nil {
+		return nil, nil
+	}
+
+	header, err := ec.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	number := header.Number.Uint64()
+	return &number, nil
+}
+
+func (s *serviceStatus) refresh() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// statusPayload returns the status document of the service, with the lag to the latest block if known
+func (n *Notify) statusPayload(status string, latest *uint64) []byte {
+	doc := Status{
+		Service: n.status.service,
+		Status:  status,
+		Version: n.Version,
+		Delay:   n.status.delay,
+		Time:    time.Now().UTC(),
+	}
+	n.status.lock.Lock()
+	if n.status.blockHeight != nil {
+		height := *n.status.blockHeight
+		doc.BlockHeight = &height
+	}
+	n.status.lock.Unlock()
+	if status == StatusOnline && latest != nil {
+		doc.LatestBlock = latest
+		if doc.BlockHeight != nil {
+			lag := int64(*latest) - int64(*doc.BlockHeight) - doc.Delay
+			doc.Lag = &lag
+		}
+	}
+
+	b, _ := json.Marshal(&doc)
+	return b
+}
+
+// statusWill returns the topic and the payload of the last will, empty if the status is disabled
+func (n *Notify) statusWill() (string, []byte) {
+	if n.status == nil || n.p.StatusTopic == "" {
+		return "", nil
+	}
+	return n.p.StatusTopic, n.statusPayload(StatusOffline, nil)
+}
+
+// refreshStatus publishes the status at the next chance, such as connected again
+func (n *Notify) refreshStatus() {
+	if n.status != nil {
+		n.status.refresh()
+	}
+}
+
+// setStatusBlockHeight records the last block handled in the status
+func (n *Notify) setStatusBlockHeight(number uint64) {
+	if n.status != nil {
+		n.status.setBlockHeight(number)
+	}
+}
+
+// setStatusClient sets the client to get the latest block in the status
+func (n *Notify) setStatusClient(ec *ethclient.Client) {
+	if n.status != nil {
+		n.status.lock.Lock()
+		n.status.ec = ec
+		n.status.lock.Unlock()
+	}
+}
+
+// runStatus publishes the status retained by the publisher periodically, and once
+// connected again. The latest block is got by the status client if set.
+func (n *Notify) runStatus(p Publisher) {
+	if n.status == nil || n.p.StatusTopic == "" {
+		return
+	}
+	interval := n.p.StatusInterval
+	if interval <= 0 {
+		interval = defaultStatusInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		latest, err := n.status.latestBlock(ctx)
+		if err != nil {
+			n.Logger.Warnln(err)
+		}
+		// the status is not kept in the outbox, the will tells the broker is lost
+		err = p.Publish(ctx, n.p.StatusTopic, n.statusPayload(StatusOnline, latest), &PublishOptions{
+			QoS:         n.p.QoS,
+			Retained:    true,
+			ContentType: "application/json",
+		})
+		cancel()
+		if err != nil {
+			n.Logger.WithField("status", n.p.StatusTopic).Warnln(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-n.status.kick:
+		}
+	}
+}
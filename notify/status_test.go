@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestStatus(t *testing.T) {
+	n := &Notify{
+		p:       &NotifyConfig{QoS: 1, StatusTopic: "newchain/status/monitor4", StatusInterval: time.Hour},
+		Version: "v0.1.0",
+		Logger:  log.New(),
+		status:  newServiceStatus(ServiceMonitor, 3),
+	}
+	n.setStatusBlockHeight(100)
+
+	var status Status
+	latest := uint64(105)
+	if err := json.Unmarshal(n.statusPayload(StatusOnline, &latest), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Service != ServiceMonitor || status.Status != StatusOnline || status.Version != "v0.1.0" || status.Delay != 3 {
+		t.Errorf("status mismatch: %+v", status)
+	}
+	if status.BlockHeight == nil || *status.BlockHeight != 100 || status.Lag == nil || *status.Lag != 2 {
+		t.Errorf("status block mismatch: %+v", status)
+	}
+
+	topic, payload := n.statusWill()
+	status = Status{}
+	if err := json.Unmarshal(payload, &status); err != nil {
+		t.Fatal(err)
+	}
+	if topic != n.p.StatusTopic || status.Status != StatusOffline || status.Lag != nil {
+		t.Errorf("will mismatch: %s %+v", topic, status)
+	}
+
+	// published retained once started, and again once refreshed
+	pub := new(recordPublisher)
+	go n.runStatus(pub)
+	n.refreshStatus()
+	deadline := time.Now().Add(time.Second)
+	for len(pub.topics()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	topics := pub.topics()
+	if len(topics) != 2 || topics[0] != n.p.StatusTopic {
+		t.Fatalf("status publish mismatch: %v", topics)
+	}
+	if opts := pub.messages[0].opts; !opts.Retained || opts.QoS != 1 {
+		t.Errorf("status options mismatch: %+v", opts)
+	}
+
+	// disabled without the topic
+	n.p.StatusTopic = ""
+	if topic, _ := n.statusWill(); topic != "" {
+		t.Errorf("will topic mismatch: have %s, want none", topic)
+	}
+}
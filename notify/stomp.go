@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-stomp/stomp/v3"
+	"github.com/go-stomp/stomp/v3/frame"
+)
+
+// stompDestination maps the topic to the STOMP destination, as is if it starts
+// with /, otherwise to the /topic/ destination by the / separators to dots and
+// the MQTT wildcards + and # to * and >, as ActiveMQ does
+func stompDestination(topic string) string {
+	if strings.HasPrefix(topic, "/") {
+		return topic
+	}
+	return "/topic/" + dotTopic(topic, "*", ">")
+}
+
+// dialSTOMP connects to the STOMP server by the host of the stomp:// server URL
+func dialSTOMP(c *NotifyConfig) (*stomp.Conn, error) {
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	opts := []func(*stomp.Conn) error{
+		stomp.ConnOpt.Host("/"),
+		stomp.ConnOpt.Header("client-id", c.ClientID),
+	}
+	if c.Username != "" {
+		opts = append(opts, stomp.ConnOpt.Login(c.Username, c.Password))
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return stomp.Dial("tcp", u.Host, opts...)
+	}
+
+	conn, err := tls.Dial("tcp", u.Host, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	stompConn, err := stomp.Connect(conn, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return stompConn, nil
+}
+
+// stompPublisher sends to the STOMP destinations of the topics. For QoS 1 and 2,
+// the messages are persistent and the receipts are requested from the server.
+type stompPublisher struct {
+	c      *NotifyConfig
+	redial *redial
+
+	lock sync.Mutex
+	conn *stomp.Conn
+}
+
+// NewSTOMPPublisher connects to the STOMP server of the config, and connects again
+// with backoff when sending after the connection is lost.
+func NewSTOMPPublisher(c *NotifyConfig) (Publisher, error) {
+	p := &stompPublisher{c: c, redial: newRedial()}
+	if _, err := p.connection(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// connection returns the connection, connects again if it is lost
+func (p *stompPublisher) connection() (*stomp.Conn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conn != nil {
+		return p.conn, nil
+	}
+	if err := p.redial.allow(); err != nil {
+		return nil, err
+	}
+	conn, err := dialSTOMP(p.c)
+	if err != nil {
+		p.redial.failed()
+		return nil, err
+	}
+	p.redial.succeeded()
+	p.conn = conn
+
+	return conn, nil
+}
+
+// lost drops the connection, so that it is connected again by the next send
+func (p *stompPublisher) lost(conn *stomp.Conn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conn == conn {
+		p.conn = nil
+		conn.MustDisconnect()
+	}
+}
+
+func (p *stompPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	conn, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	var sendOpts []func(*frame.Frame) error
+	if opts.QoS > 0 {
+		sendOpts = append(sendOpts, stomp.SendOpt.Receipt, stomp.SendOpt.Header("persistent", "true"))
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- conn.Send(stompDestination(topic), "application/json", payload, sendOpts...)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			p.lost(conn)
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *stompPublisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Disconnect()
+	p.conn = nil
+	return err
+}
+
+// subscribeSTOMP subscribes the destination of the topic. For QoS 1 and 2, the
+// messages are acknowledged individually once handled, or negatively acknowledged
+// if failed.
+func (n *Notify) subscribeSTOMP(f messageHandler) (<-chan error, error) {
+	conn, err := dialSTOMP(n.s)
+	if err != nil {
+		return nil, err
+	}
+
+	ack := stomp.AckAuto
+	if n.s.QoS > 0 {
+		ack = stomp.AckClientIndividual
+	}
+	sub, err := conn.Subscribe(stompDestination(n.s.Topic), ack)
+	if err != nil {
+		conn.MustDisconnect()
+		return nil, err
+	}
+
+	lost := make(chan error, 1)
+	go func() {
+		defer conn.MustDisconnect()
+		for msg := range sub.C {
+			if msg.Err != nil {
+				lost <- msg.Err
+				return
+			}
+			if err := f(n.s.Topic, msg.Body); err != nil {
+				n.Logger.Warnf("STOMP message not handled: %v", err)
+				if msg.ShouldAck() {
+					if err := conn.Nack(msg); err != nil {
+						n.Logger.Errorln(err)
+					}
+				}
+				continue
+			}
+			if msg.ShouldAck() {
+				if err := conn.Ack(msg); err != nil {
+					n.Logger.Errorln(err)
+				}
+			}
+		}
+		lost <- errors.New("stomp subscription closed")
+	}()
+
+	return lost, nil
+}
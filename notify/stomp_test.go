@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp/v3/server"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSTOMPDestination(t *testing.T) {
+	tests := []struct {
+		topic, destination string
+	}{
+		{"RawTransaction", "/topic/RawTransaction"},
+		{"newchain/+/4", "/topic/newchain.*.4"},
+		{"newchain/#", "/topic/newchain.>"},
+		{"/queue/Transfer", "/queue/Transfer"},
+	}
+	for _, tt := range tests {
+		if destination := stompDestination(tt.topic); destination != tt.destination {
+			t.Errorf("destination of %s: have %s, want %s", tt.topic, destination, tt.destination)
+		}
+	}
+}
+
+func TestSTOMPPublishSubscribe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Serve(l)
+
+	// the in-process server does not acknowledge the topic messages, so subscribe by QoS 0
+	c := &NotifyConfig{
+		Server:   "stomp://" + l.Addr().String(),
+		ClientID: "test",
+		Topic:    "newchain/abc/4",
+	}
+	n := &Notify{s: c, p: c, Logger: log.New(), quit: make(chan struct{}, 1)}
+
+	received := make(chan []byte, 1)
+	lost, err := n.subscribeSTOMP(func(topic string, payload []byte) error {
+		if topic != c.Topic {
+			t.Errorf("topic mismatch: have %s, want %s", topic, c.Topic)
+		}
+		select {
+		case received <- payload:
+		default:
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewSTOMPPublisher(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// the subscription is set up by the server asynchronously, so publish till received
+	payload := []byte(`{"hash":"0x01"}`)
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := p.Publish(context.Background(), c.Topic, payload, &PublishOptions{QoS: 1}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case have := <-received:
+			if string(have) != string(payload) {
+				t.Errorf("payload mismatch: have %s, want %s", have, payload)
+			}
+			return
+		case err := <-lost:
+			t.Fatal(err)
+		case <-deadline:
+			t.Fatal("timeout waiting for the message")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
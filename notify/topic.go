@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/address"
+)
+
+const (
+	// DefaultTopicTemplate is the address topic layout, PrefixTopic/<address>/<confirmations>
+	DefaultTopicTemplate = "{prefix}{address}/{confirmations}"
+	// DefaultContractCreateTemplate is the topic of the contract creations
+	DefaultContractCreateTemplate = "{prefix}ContractCreate"
+)
+
+// the variables of the topic templates
+const (
+	topicVarPrefix        = "prefix"
+	topicVarAddress       = "address" // the receiver, or the sender for the contract creation
+	topicVarFrom          = "from"
+	topicVarTo            = "to"
+	topicVarConfirmations = "confirmations"
+	topicVarType          = "type"
+	topicVarChainID       = "chainId"
+)
+
+// the formats of the address variables, such as {address:checksum}
+const (
+	addressFormatHex      = "hex"      // lowercase without 0x, the default
+	addressFormatPrefixed = "0x"       // lowercase with 0x
+	addressFormatChecksum = "checksum" // EIP-55 mixed case with 0x
+	addressFormatNEW      = "new"      // NEW address of the ChainID
+)
+
+var (
+	topicVars      = []string{topicVarPrefix, topicVarAddress, topicVarFrom, topicVarTo, topicVarConfirmations, topicVarType, topicVarChainID}
+	addressFormats = []string{addressFormatHex, addressFormatPrefixed, addressFormatChecksum, addressFormatNEW}
+)
+
+// topicPart is the literal, or the variable with the format, of the topic template
+type topicPart struct {
+	literal string
+	name    string
+	format  string
+}
+
+// TopicTemplate is the parsed template of the topics, with the variables in braces
+// such as {prefix}{address:checksum}/{confirmations}
+type TopicTemplate struct {
+	raw   string
+	parts []topicPart
+}
+
+// ParseTopicTemplate parses and validates the topic template
+func ParseTopicTemplate(s string) (*TopicTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("topic template is empty")
+	}
+	if strings.ContainsAny(s, "+#") {
+		return nil, fmt.Errorf("topic template %s can not contain the wildcards", s)
+	}
+
+	t := &TopicTemplate{raw: s}
+	for rest := s; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("topic template %s has unmatched }", s)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, topicPart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, topicPart{literal: rest[:open]})
+		}
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return nil, fmt.Errorf("topic template %s has unmatched {", s)
+		}
+		close += open
+
+		part := topicPart{name: rest[open+1 : close]}
+		if i := strings.IndexByte(part.name, ':'); i >= 0 {
+			part.name, part.format = part.name[:i], part.name[i+1:]
+		}
+		if !stringInSlice(part.name, topicVars) {
+			return nil, fmt.Errorf("topic template %s has unknown variable {%s}, only %s", s, part.name, strings.Join(topicVars, ","))
+		}
+		if part.format != "" {
+			if !isAddressVar(part.name) {
+				return nil, fmt.Errorf("topic template %s has format of non-address variable {%s}", s, part.name)
+			}
+			if !stringInSlice(part.format, addressFormats) {
+				return nil, fmt.Errorf("topic template %s has unknown address format %s, only %s", s, part.format, strings.Join(addressFormats, ","))
+			}
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[close+1:]
+	}
+
+	return t, nil
+}
+
+func isAddressVar(name string) bool {
+	return name == topicVarAddress || name == topicVarFrom || name == topicVarTo
+}
+
+// Uses checks whether the template uses the variable
+func (t *TopicTemplate) Uses(name string) bool {
+	for _, part := range t.parts {
+		if part.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// usesFormat checks whether the template uses the address format
+func (t *TopicTemplate) usesFormat(format string) bool {
+	for _, part := range t.parts {
+		if isAddressVar(part.name) && part.format == format {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TopicTemplate) String() string {
+	return t.raw
+}
+
+// topicValues is the values of the variables to render the topic template
+type topicValues struct {
+	prefix        string
+	address       *common.Address
+	from          common.Address
+	to            *common.Address
+	confirmations int64
+	event         string // in place of {confirmations} for the events apart from the confirmations
+	typ           string
+	chainID       uint64
+}
+
+// render returns the topic by the values, the addresses missing are empty
+func (t *TopicTemplate) render(v *topicValues) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		switch part.name {
+		case "":
+			b.WriteString(part.literal)
+		case topicVarPrefix:
+			b.WriteString(v.prefix)
+		case topicVarAddress:
+			b.WriteString(formatAddress(v.address, part.format, v.chainID))
+		case topicVarFrom:
+			b.WriteString(formatAddress(&v.from, part.format, v.chainID))
+		case topicVarTo:
+			b.WriteString(formatAddress(v.to, part.format, v.chainID))
+		case topicVarConfirmations:
+			if v.event != "" {
+				b.WriteString(v.event)
+				continue
+			}
+			b.WriteString(strconv.FormatInt(v.confirmations, 10))
+		case topicVarType:
+			b.WriteString(v.typ)
+		case topicVarChainID:
+			b.WriteString(strconv.FormatUint(v.chainID, 10))
+		}
+	}
+	return b.String()
+}
+
+// formatAddress formats the address in the topic, empty if nil
+func formatAddress(addr *common.Address, format string, chainID uint64) string {
+	if addr == nil {
+		return ""
+	}
+	switch format {
+	case addressFormatNEW:
+		return address.ToNEW(*addr, chainID)
+	case addressFormatPrefixed:
+		return strings.ToLower(addr.Hex())
+	case addressFormatChecksum:
+		return addr.Hex()
+	default:
+		return strings.ToLower(addr.Hex()[2:])
+	}
+}
+
+// parseTopicTemplates parses the topic templates of the publish config, the default layout if empty,
+// and checks the ChainID is set for the NEW addresses
+func (n *Notify) parseTopicTemplates() error {
+	topic, create := n.p.TopicTemplate, n.p.ContractCreateTemplate
+	if topic == "" {
+		topic = DefaultTopicTemplate
+	}
+	if create == "" {
+		create = DefaultContractCreateTemplate
+	}
+
+	var err error
+	if n.topicTemplate, err = ParseTopicTemplate(topic); err != nil {
+		return err
+	}
+	if n.createTemplate, err = ParseTopicTemplate(create); err != nil {
+		return err
+	}
+	for _, t := range []*TopicTemplate{n.topicTemplate, n.createTemplate} {
+		if t.Uses(topicVarChainID) && n.p.ChainID == 0 {
+			return fmt.Errorf("topic template %s uses {chainId} but ChainID is not set", t)
+		}
+		if t.usesFormat(addressFormatNEW) && n.p.ChainID == 0 {
+			return fmt.Errorf("topic template %s uses the NEW address but ChainID is not set", t)
+		}
+	}
+	if n.createTemplate.Uses(topicVarTo) {
+		return fmt.Errorf("contract create template %s can not use {to}", n.createTemplate)
+	}
+	if n.p.NEWAddress && n.p.ChainID == 0 {
+		return errors.New("NEWAddress is set but ChainID is not set")
+	}
+
+	return nil
+}
+
+func stringInSlice(str string, list []string) bool {
+	for _, v := range list {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/address"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestParseTopicTemplate(t *testing.T) {
+	for _, s := range []string{DefaultTopicTemplate, DefaultContractCreateTemplate, "{prefix}{chainId}/{type}/{to:checksum}/{from:0x}/{address:hex}", "{address:new}"} {
+		tt, err := ParseTopicTemplate(s)
+		if err != nil {
+			t.Errorf("parse %s: %v", s, err)
+			continue
+		}
+		if tt.String() != s {
+			t.Errorf("template mismatch: have %s, want %s", tt, s)
+		}
+	}
+
+	for _, s := range []string{"", "{prefix}+/{confirmations}", "{prefix}#", "{prefix", "prefix}", "{value}", "{type:checksum}", "{address:upper}"} {
+		if _, err := ParseTopicTemplate(s); err == nil {
+			t.Errorf("parse %s: want error", s)
+		}
+	}
+}
+
+func TestBrokerTopic(t *testing.T) {
+	from := common.HexToAddress("0xe028d0363813d19d8c76886bd6b32dacf50b7a6d")
+	to := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+	tx := &TransferTx{From: from, To: &to, Value: big.NewInt(1), BlockNumber: big.NewInt(1)}
+	create := &TransferTx{From: from, Value: big.NewInt(0), BlockNumber: big.NewInt(1)}
+
+	tests := []struct {
+		topic, create string
+		chainID       uint64
+		want          [2]string
+	}{
+		{"", "", 0, [2]string{"newchain/97549e368acafdcae786bb93d98379f1d1561a29/4", "newchain/ContractCreate"}},
+		{"{prefix}{chainId}/{type}/{address:checksum}/{confirmations}", "{prefix}{chainId}/create/{address:0x}", 1012,
+			[2]string{"newchain/1012/confirmed/0x97549E368AcaFdCAE786BB93D98379f1D1561a29/4", "newchain/1012/create/0xe028d0363813d19d8c76886bd6b32dacf50b7a6d"}},
+		{"{from}/{to}", "", 0, [2]string{"e028d0363813d19d8c76886bd6b32dacf50b7a6d/97549e368acafdcae786bb93d98379f1d1561a29", "newchain/ContractCreate"}},
+		{"{prefix}{address:new}", "{prefix}create/{from:new}", 1012,
+			[2]string{"newchain/" + address.ToNEW(to, 1012), "newchain/create/" + address.ToNEW(from, 1012)}},
+	}
+	for _, test := range tests {
+		n := &Notify{p: &NotifyConfig{PrefixTopic: "newchain/", TopicTemplate: test.topic, ContractCreateTemplate: test.create, ChainID: test.chainID}}
+		if err := n.parseTopicTemplates(); err != nil {
+			t.Fatal(err)
+		}
+		for i, tx := range []*TransferTx{tx, create} {
+			if topic := n.brokerTopic(tx, 4); topic != test.want[i] {
+				t.Errorf("topic mismatch: have %s, want %s", topic, test.want[i])
+			}
+		}
+	}
+
+	for _, c := range []*NotifyConfig{
+		{TopicTemplate: "{chainId}/{address}"},
+		{ContractCreateTemplate: "{to}"},
+		{TopicTemplate: "{address:new}"},
+		{NEWAddress: true},
+	} {
+		n := &Notify{p: c}
+		if err := n.parseTopicTemplates(); err == nil {
+			t.Errorf("parse %+v: want error", c)
+		}
+	}
+
+	// the sinks have the default layout
+	n := &Notify{p: &NotifyConfig{PrefixTopic: "newchain/", TopicTemplate: "{prefix}{address:checksum}"}, Logger: log.New()}
+	if err := n.parseTopicTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	broker, sinks := new(recordPublisher), new(recordPublisher)
+	if err := n.publishToBlockTopic(&routePublisher{broker: broker, sinks: sinks}, tx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if topics := broker.topics(); len(topics) != 1 || topics[0] != "newchain/0x97549E368AcaFdCAE786BB93D98379f1D1561a29" {
+		t.Errorf("broker topic mismatch: %v", topics)
+	}
+	if topics := sinks.topics(); len(topics) != 1 || topics[0] != "newchain/97549e368acafdcae786bb93d98379f1d1561a29/4" {
+		t.Errorf("sink topic mismatch: %v", topics)
+	}
+}
+
+func TestNEWAddressPayload(t *testing.T) {
+	from := common.HexToAddress("0xe028d0363813d19d8c76886bd6b32dacf50b7a6d")
+	to := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+
+	for _, newAddress := range []bool{false, true} {
+		n := &Notify{p: &NotifyConfig{PrefixTopic: "newchain/", ChainID: 1012, NEWAddress: newAddress}, Logger: log.New()}
+		pub := new(recordPublisher)
+		tx := &TransferTx{From: from, To: &to, Value: big.NewInt(1), BlockNumber: big.NewInt(1)}
+		if err := n.publishToBlockTopic(pub, tx, 4); err != nil {
+			t.Fatal(err)
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(pub.messages[0].payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if !newAddress {
+			if _, ok := payload["newFrom"]; ok {
+				t.Errorf("payload has newFrom without NEWAddress: %v", payload)
+			}
+			continue
+		}
+		if payload["newFrom"] != address.ToNEW(from, 1012) || payload["newTo"] != address.ToNEW(to, 1012) {
+			t.Errorf("NEW address mismatch: %v", payload)
+		}
+		if payload["to"] != strings.ToLower(to.Hex()) {
+			t.Errorf("hex address mismatch: %v", payload)
+		}
+	}
+}
@@ -4,49 +4,156 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
-	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
 	"github.com/newtonproject/newchain-notify/queue"
 )
 
+// TxAge is a transaction waiting for confirmation
 type TxAge struct {
-	tx  *TransferTx
-	age uint64
-	c   mqtt.Client
+	tx     *TransferTx
+	since  time.Time
+	queued uint64 // the block number the transaction is queued or announced at
+	checks uint64 // the number of checks since queued
+
+	// the inclusion block of the included or announced transaction
+	announced   bool
+	blockNumber *big.Int
+	blockHash   common.Hash
+	status      *uint64
+
+	restored bool // queued by the versions before the block-keyed queue, checks is the blocks checked
+}
+
+// txAgeCodec encodes TxAge for the durable queue
+type txAgeCodec struct{}
+
+type txAgeJSON struct {
+	Tx     *TransferTx `json:"tx"`
+	Since  time.Time   `json:"since"`
+	Queued uint64      `json:"queued"`
+	Checks uint64      `json:"checks,omitempty"`
+
+	Announced   bool            `json:"announced,omitempty"`
+	BlockNumber *hexutil.Big    `json:"blockNumber,omitempty"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	Status      *hexutil.Uint64 `json:"status,omitempty"`
+
+	Age *uint64 `json:"age,omitempty"` // the blocks checked, only by the versions before the block-keyed queue
+}
+
+func (txAgeCodec) Encode(data interface{}) ([]byte, error) {
+	txAge, ok := data.(TxAge)
+	if !ok {
+		return nil, errors.New("only TxAge can be encoded")
+	}
+	return json.Marshal(&txAgeJSON{
+		Tx:          txAge.tx,
+		Since:       txAge.since,
+		Queued:      txAge.queued,
+		Checks:      txAge.checks,
+		Announced:   txAge.announced,
+		BlockNumber: (*hexutil.Big)(txAge.blockNumber),
+		BlockHash:   txAge.blockHash,
+		Status:      (*hexutil.Uint64)(txAge.status),
+	})
+}
+
+func (txAgeCodec) Decode(b []byte) (interface{}, error) {
+	var dec txAgeJSON
+	if err := json.Unmarshal(b, &dec); err != nil {
+		return nil, err
+	}
+	if dec.Tx == nil {
+		return nil, errors.New("tx is nil")
+	}
+	if dec.Announced && dec.BlockNumber == nil {
+		return nil, errors.New("block number of announced tx is nil")
+	}
+	if dec.Age != nil {
+		return TxAge{tx: dec.Tx, since: dec.Since, checks: *dec.Age, restored: true}, nil
+	}
+	return TxAge{
+		tx:          dec.Tx,
+		since:       dec.Since,
+		queued:      dec.Queued,
+		checks:      dec.Checks,
+		announced:   dec.Announced,
+		blockNumber: (*big.Int)(dec.BlockNumber),
+		blockHash:   dec.BlockHash,
+		status:      (*uint64)(dec.Status),
+	}, nil
+}
+
+// receivedTx is the subscribed transaction, done receives the result of queuing it
+type receivedTx struct {
+	tx   *TransferTx
+	done chan<- error
 }
 
 type TransaferNotify struct {
 	Notify
 
-	rpcURL string
-	block  int64
-	ec     *ethclient.Client
+	rpcURL      string
+	block       int64
+	confirmMode string
+	drop        *DropConfig
+	queuePath   string // the path of the durable queue, empty for memory only
+	ec          *ethclient.Client
+	rc          *rpc.Client
 
 	// blockCh chan types.Block
 	// q   *queue.Queue
 }
 
-func NewTransferNotify(s, p *NotifyConfig, rpcURL string, block int64, logger *log.Logger) (*TransaferNotify, error) {
+func NewTransferNotify(s, p *NotifyConfig, rpcURL string, block int64, confirmMode string, drop *DropConfig, queuePath string, logger *log.Logger) (*TransaferNotify, error) {
 	if s == nil || p == nil {
 		return nil, errors.New("subscribe or publish config can not be nil")
 	}
-	return &TransaferNotify{
+	if confirmMode == "" {
+		confirmMode = ConfirmBlock
+	}
+	if confirmMode != ConfirmBlock && confirmMode != ConfirmReceipt {
+		return nil, fmt.Errorf("confirm mode only %s or %s", ConfirmBlock, ConfirmReceipt)
+	}
+	if drop == nil {
+		drop = &DropConfig{Mode: DropByBlock}
+	}
+	if drop.Mode == DropByBlock && drop.Blocks == 0 {
+		drop.Blocks = uint64(block + 10)
+	}
+	if err := drop.check(); err != nil {
+		return nil, err
+	}
+	n := &TransaferNotify{
 		Notify: Notify{
 			s:      s,
 			p:      p,
 			Logger: logger,
 			quit:   make(chan struct{}, 1),
+			status: newServiceStatus(ServiceTransfer, block),
 		},
-		block:  block,
-		rpcURL: rpcURL,
+		block:       block,
+		confirmMode: confirmMode,
+		drop:        drop,
+		queuePath:   queuePath,
+		rpcURL:      rpcURL,
 		// blockCh:    make(chan types.Block, 1),
 		// q:      queue.New(),
-	}, nil
+	}
+	if err := n.parseTopicTemplates(); err != nil {
+		return nil, err
+	}
+
+	return n, nil
 }
 
 // MarshalJSON encodes to json format.
@@ -56,6 +163,9 @@ func (n *TransaferNotify) MarshalJSON() ([]byte, error) {
 		Publish     *NotifyConfig
 		RPCURL      string
 		DelayBlock  int64
+		ConfirmMode string
+		Drop        *DropConfig
+		QueuePath   string
 		LoggerLevel string
 	}
 
@@ -64,6 +174,9 @@ func (n *TransaferNotify) MarshalJSON() ([]byte, error) {
 		Publish:     n.p,
 		RPCURL:      n.rpcURL,
 		DelayBlock:  n.block,
+		ConfirmMode: n.confirmMode,
+		Drop:        n.drop,
+		QueuePath:   n.queuePath,
 		LoggerLevel: n.Logger.Level.String(),
 	}
 	n.p.Topic = "-"
@@ -76,50 +189,72 @@ func (n *TransaferNotify) Run() error {
 		n.Logger = log.New()
 	}
 
-	ec, err := ethclient.Dial(n.rpcURL)
+	rc, err := rpc.Dial(n.rpcURL)
 	if err != nil {
 		return err
 	}
+	ec := ethclient.NewClient(rc)
+	n.rc, n.ec = rc, ec
+	n.setStatusClient(ec)
 
-	blockCh := make(chan *types.Block, 10)
-	q := queue.New()
-	go n.getBlockTicker(ec, n.block, blockCh)
-	go n.runBlockCheck(q, blockCh)
-
-	ch := make(chan string, 10)
-	onMessageReceived := func(c mqtt.Client, message mqtt.Message) {
-		if message != nil && message.Topic() == n.s.Topic {
-			ch <- string(message.Payload())
-		}
+	q, err := queue.OpenDurableDelay(n.queuePath, txAgeCodec{})
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if size := q.Size(); size > 0 {
+		n.Logger.Infof("Restored %d transactions from %s", size, n.queuePath)
+	}
+	if corrupted := q.Corrupted(); corrupted > 0 {
+		n.Logger.Warnf("Moved aside %d transactions failed to decode in %s", corrupted, n.queuePath)
 	}
 
-	pClient, err := n.getPublishClient()
+	pub, err := n.getPublisher()
 	if err != nil {
 		n.quit <- struct{}{}
 		return err
 	}
-	if pClient == nil {
+	if pub == nil {
 		n.quit <- struct{}{}
-		return errors.New("publish client nil")
+		return errors.New("publisher nil")
+	}
+
+	blockCh := make(chan *types.Block, 10)
+	txCh := make(chan receivedTx, 10)
+	go n.getBlockTicker(ec, n.block, blockCh)
+	go n.runBlockCheck(q, pub, blockCh, txCh)
+
+	// the message is handled once the transaction is written to the queue
+	ch := make(chan received, 10)
+	onMessageReceived := func(topic string, payload []byte) error {
+		if topic != n.s.Topic {
+			return nil
+		}
+		done := make(chan error, 1)
+		ch <- received{payload: payload, done: done}
+		return <-done
 	}
 
 	go func() {
 		for {
 			select {
-			case raw := <-ch:
+			case r := <-ch:
+				raw := string(r.payload)
 				n.Logger.WithFields(log.Fields{
 					"subscribe": n.s.Topic,
 				}).Info(raw)
 				tx, err := decodeTransferTx(raw)
 				if err != nil {
 					n.Logger.Errorln(err)
+					r.done <- nil
 					continue
 				}
 				if tx == nil {
 					n.Logger.Errorln(errors.New("tx is nil"))
+					r.done <- nil
 					continue
 				}
-				q.Push(TxAge{tx: tx, age: 0, c: pClient})
+				txCh <- receivedTx{tx: tx, done: r.done}
 			case <-n.quit:
 				return
 			}
@@ -231,49 +366,49 @@ func (n *TransaferNotify) getBlockTicker(ec *ethclient.Client, blockDelay int64,
 
 }
 
-func (n *TransaferNotify) runBlockCheck(q *queue.Queue, blockCh chan *types.Block) {
-	var blockList []*types.Block
-	limitBlock := n.block + 10
-	limitTx := uint64(limitBlock)
-	for block := range blockCh {
-		if block == nil {
-			n.Logger.Errorln("get nil block")
-			continue
-		}
-		blockList = append(blockList, block)
-
-		size := q.Size()
-		for i := 0; (!q.Empty()) && (i < size); i++ {
-			func() {
-				p := q.Pop()
-				if p == nil {
-					return
-				}
-				txAge := p.(TxAge)
-				tx := txAge.tx
-				for _, b := range blockList {
-					for _, t := range b.Transactions() {
-						if t.Hash() == tx.Hash {
-							n.publishToBlockTopic(txAge.c, tx, n.block+1)
-							return
-						}
-					}
-				}
-
-				if txAge.age > limitTx {
-					n.Logger.Warnln("discard transaction ", tx.Hash.String())
-					return
-				}
-				txAge.age++
+// runBlockCheck checks the queued transactions on every block, and queues the
+// new transactions once the first block is checked.
+func (n *TransaferNotify) runBlockCheck(q *queue.DurableDelay, p Publisher, blockCh <-chan *types.Block, txCh <-chan receivedTx) {
+	t := newTransferChecker(n, q, p)
 
-				q.Push(txAge)
-			}()
+	// not until the first block, which is the block the new transactions are queued at
+	var in <-chan receivedTx
+	for {
+		select {
+		case block := <-blockCh:
+			if block == nil {
+				n.Logger.Errorln("get nil block")
+				continue
+			}
+			t.check(block)
+			n.setStatusBlockHeight(block.NumberU64())
+			in = txCh
+		case r := <-in:
+			r.done <- t.add(r.tx)
 		}
+	}
+}
 
-		if int64(len(blockList)) > limitBlock {
-			blockList = blockList[int64(len(blockList))-limitBlock:]
-		}
+// publishUnconfirmed publishes the unconfirmed event to PrefixTopic/<address>/unconfirmed,
+// never to the confirmation topic, so it is not taken as another confirmation. The
+// contract creation has no address topic for the event.
+func (n *TransaferNotify) publishUnconfirmed(p Publisher, txAge *TxAge) {
+	tx := *txAge.tx
+	tx.Event = EventUnconfirmed
+	tx.BlockNumber = txAge.blockNumber
+	if tx.To != nil {
+		n.publishToEventTopic(p, &tx)
+	}
+}
+
+// publishDropped publishes the dropped event to PrefixTopic/<address>/dropped and the
+// dropped topic, never to the confirmation topic
+func (n *TransaferNotify) publishDropped(p Publisher, tx *TransferTx) {
+	tx.Event = EventDropped
+	if tx.To != nil {
+		n.publishToEventTopic(p, tx)
 	}
+	n.publishToTopic(p, n.drop.Topic, tx)
 }
 
 func decodeTransferTx(hexParam string) (*TransferTx, error) {
@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-notify/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookTopicHeader is the header of the topic the notification is published to
+	WebhookTopicHeader = "X-Notify-Topic"
+	// WebhookTimestampHeader is the header of the unix time the request is signed at
+	WebhookTimestampHeader = "X-Notify-Timestamp"
+	// WebhookSignatureHeader is the header of the signature, "sha256=" followed by
+	// the hex HMAC-SHA256 of the timestamp, a dot and the body by the secret
+	WebhookSignatureHeader = "X-Notify-Signature"
+
+	defaultWebhookTimeout      = 10 * time.Second
+	defaultWebhookRetryBackoff = time.Second
+	defaultWebhookMaxBackoff   = time.Minute
+	defaultWebhookWorkers      = 4
+	defaultWebhookQueueSize    = 1024
+)
+
+// WebhookRoute posts the notifications matching the pattern to the URL. The pattern
+// is an MQTT topic filter with the + and # wildcards, or an address which matches
+// the notifications from or to it.
+type WebhookRoute struct {
+	Pattern string
+	URL     string
+}
+
+// WebhookConfig is the config of the webhook publisher
+type WebhookConfig struct {
+	Routes       []WebhookRoute
+	Secret       string        `json:"-"`
+	Timeout      time.Duration // the timeout of each request
+	MaxRetries   int           // the retries after the first failed request
+	RetryBackoff time.Duration // the wait before the first retry, doubled after each retry
+	MaxBackoff   time.Duration
+	DeadLetter   string // the file to append the failed deliveries, discarded if empty
+	Workers      int    // the number of the concurrent deliveries
+	QueueSize    int    // the number of the notifications waiting for delivery, the overflow is dead-lettered
+}
+
+// webhookDelivery is a notification to post to a URL
+type webhookDelivery struct {
+	url     string
+	topic   string
+	payload []byte
+}
+
+// deadLetter is a line of the dead-letter file
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	URL      string          `json:"url"`
+	Topic    string          `json:"topic"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// webhookPublisher posts the notifications to the routes by the background
+// workers, so that a slow or failing HTTP service does not hold up the others.
+type webhookPublisher struct {
+	config *WebhookConfig
+	client *http.Client
+	logger *log.Logger
+
+	q    *queue.Concurrent
+	wg   sync.WaitGroup
+	stop chan struct{} // closed by Close to skip the remaining retries
+
+	lock       sync.Mutex
+	deadLetter *os.File
+}
+
+// NewWebhookPublisher creates the webhook publisher and starts its workers. Publish
+// returns once the notification is queued for all the matched routes, the failed
+// deliveries are retried and then written to the dead-letter file. Publish never
+// waits for a full queue, the notification is written to the dead-letter file
+// instead, so that a slow or down HTTP service does not hold up the other sinks.
+func NewWebhookPublisher(c *WebhookConfig, logger *log.Logger) (Publisher, error) {
+	if c == nil || len(c.Routes) == 0 {
+		return nil, errors.New("webhook routes can not be empty")
+	}
+	for _, route := range c.Routes {
+		if route.Pattern == "" || route.URL == "" {
+			return nil, errors.New("webhook route pattern and url can not be empty")
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWebhookTimeout
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultWebhookRetryBackoff
+	}
+	if c.MaxBackoff < c.RetryBackoff {
+		c.MaxBackoff = defaultWebhookMaxBackoff
+		if c.MaxBackoff < c.RetryBackoff {
+			c.MaxBackoff = c.RetryBackoff
+		}
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWebhookWorkers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultWebhookQueueSize
+	}
+	if logger == nil {
+		logger = log.New()
+	}
+
+	p := &webhookPublisher{
+		config: c,
+		client: &http.Client{Timeout: c.Timeout},
+		logger: logger,
+		q:      queue.NewConcurrent(c.QueueSize, queue.Reject),
+		stop:   make(chan struct{}),
+	}
+	if c.DeadLetter != "" {
+		f, err := os.OpenFile(c.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		p.deadLetter = f
+	}
+
+	for i := 0; i < c.Workers; i++ {
+		p.wg.Add(1)
+		go p.run()
+	}
+
+	return p, nil
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, topic string, payload []byte, opts *PublishOptions) error {
+	for _, route := range p.config.Routes {
+		if !matchRoute(route.Pattern, topic, payload) {
+			continue
+		}
+		d := &webhookDelivery{url: route.URL, topic: topic, payload: payload}
+		if err := p.q.Push(ctx, d); err == queue.ErrFull {
+			p.logger.WithFields(log.Fields{
+				"webhook": d.url,
+			}).Warnln(err)
+			p.writeDeadLetter(d, 0, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close waits for the queued notifications, each of them is tried once more at most.
+func (p *webhookPublisher) Close() error {
+	p.q.Close()
+	close(p.stop)
+	p.wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.deadLetter != nil {
+		return p.deadLetter.Close()
+	}
+	return nil
+}
+
+func (p *webhookPublisher) run() {
+	defer p.wg.Done()
+	for {
+		data, err := p.q.Pop(context.Background())
+		if err != nil {
+			return
+		}
+		p.deliver(data.(*webhookDelivery))
+	}
+}
+
+// deliver posts the notification till it succeeds or the retries run out
+func (p *webhookPublisher) deliver(d *webhookDelivery) {
+	backoff := p.config.RetryBackoff
+	attempts := 0
+	for {
+		attempts++
+		retry, err := p.post(d)
+		if err == nil {
+			return
+		}
+		p.logger.WithFields(log.Fields{
+			"webhook": d.url,
+			"attempt": attempts,
+		}).Warnln(err)
+
+		if !retry || attempts > p.config.MaxRetries {
+			p.writeDeadLetter(d, attempts, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-p.stop:
+			p.writeDeadLetter(d, attempts, err)
+			return
+		}
+		backoff *= 2
+		if backoff > p.config.MaxBackoff {
+			backoff = p.config.MaxBackoff
+		}
+	}
+}
+
+// post posts the notification once, and returns whether it is worth retrying if failed
+func (p *webhookPublisher) post(d *webhookDelivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTopicHeader, d.topic)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if p.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(p.config.Secret, timestamp, d.payload))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook response status %s", resp.Status)
+}
+
+func (p *webhookPublisher) writeDeadLetter(d *webhookDelivery, attempts int, err error) {
+	if p.deadLetter == nil {
+		p.logger.WithFields(log.Fields{
+			"webhook": d.url,
+		}).Errorln("discard notification ", d.topic)
+		return
+	}
+
+	payload := json.RawMessage(d.payload)
+	if !json.Valid(d.payload) {
+		payload, _ = json.Marshal(string(d.payload))
+	}
+	b, merr := json.Marshal(&deadLetter{
+		Time:     time.Now(),
+		URL:      d.url,
+		Topic:    d.topic,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  payload,
+	})
+	if merr != nil {
+		p.logger.Errorln(merr)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, err := p.deadLetter.Write(append(b, '\n')); err != nil {
+		p.logger.Errorln(err)
+	}
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of the timestamp, a dot and the body by the secret
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// matchRoute checks whether the notification matches the route pattern
+func matchRoute(pattern, topic string, payload []byte) bool {
+	if !common.IsHexAddress(pattern) {
+		return matchTopic(pattern, topic)
+	}
+
+	address := common.HexToAddress(pattern)
+	for _, level := range strings.Split(topic, "/") {
+		if strings.EqualFold(level, address.Hex()[2:]) {
+			return true
+		}
+	}
+	var tx struct {
+		From *common.Address `json:"from"`
+		To   *common.Address `json:"to"`
+	}
+	if err := json.Unmarshal(payload, &tx); err != nil {
+		return false
+	}
+	return (tx.From != nil && *tx.From == address) || (tx.To != nil && *tx.To == address)
+}
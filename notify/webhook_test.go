@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newtonproject/newchain-notify/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"#", "newchain/abc/4", true},
+		{"newchain/#", "newchain/abc/4", true},
+		{"newchain/+/4", "newchain/abc/4", true},
+		{"newchain/+/4", "newchain/abc/0", false},
+		{"newchain/+", "newchain/abc/4", false},
+		{"Transfer4", "Transfer4", true},
+		{"Transfer4", "Transfer", false},
+	}
+	for _, tt := range tests {
+		if match := matchTopic(tt.filter, tt.topic); match != tt.match {
+			t.Errorf("match %s %s: have %v, want %v", tt.filter, tt.topic, match, tt.match)
+		}
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	const secret = "secret"
+
+	var (
+		lock     sync.Mutex
+		attempts int
+		failures int
+		bodies   [][]byte
+	)
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+SignWebhook(secret, timestamp, body) {
+			t.Errorf("signature mismatch: %s", r.Header.Get(WebhookSignatureHeader))
+		}
+		if r.Header.Get(WebhookTopicHeader) == "" {
+			t.Errorf("topic header is empty")
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, body)
+	}))
+	defer ok.Close()
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		failures++
+		lock.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fail.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetterPath := filepath.Join(dir, "dead.jsonl")
+
+	txs := newSignedTransactions(t, 1)
+	tx, err := newPendingTransferTx(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewWebhookPublisher(&WebhookConfig{
+		Routes: []WebhookRoute{
+			{Pattern: tx.To.Hex(), URL: ok.URL},
+			{Pattern: "newchain/+/4", URL: fail.URL},
+			{Pattern: "Other", URL: fail.URL},
+		},
+		Secret:       secret,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		DeadLetter:   deadLetterPath,
+		Workers:      2,
+	}, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "newchain/abc/4", payload, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		done := len(bodies) == 1 && failures == 4
+		lock.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 1 || string(bodies[0]) != string(payload) {
+		t.Errorf("body mismatch: have %s, want %s", bodies, payload)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts mismatch: have %v, want %v", attempts, 3)
+	}
+
+	f, err := os.Open(deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var letters []deadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("dead letter count mismatch: have %v, want %v", len(letters), 1)
+	}
+	if letters[0].URL != fail.URL || letters[0].Attempts != 4 || string(letters[0].Payload) != string(payload) {
+		t.Errorf("dead letter mismatch: %+v", letters[0])
+	}
+}
+
+func TestWebhookPublisherFull(t *testing.T) {
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stalled.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetterPath := filepath.Join(dir, "dead.jsonl")
+
+	p, err := NewWebhookPublisher(&WebhookConfig{
+		Routes:     []WebhookRoute{{Pattern: "#", URL: stalled.URL}},
+		DeadLetter: deadLetterPath,
+		Workers:    1,
+		QueueSize:  1,
+	}, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one is posted by the worker and one is queued at most, the others overflow
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 4; i++ {
+		if err := p.Publish(ctx, "newchain/abc/4", []byte(`{}`), nil); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	close(release)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var letters []deadLetter
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) < 2 {
+		t.Fatalf("dead letter count mismatch: have %v, want 2 at least", len(letters))
+	}
+	for _, letter := range letters {
+		if letter.Attempts != 0 || letter.Error != queue.ErrFull.Error() {
+			t.Errorf("dead letter mismatch: %+v", letter)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebSocketConfig is the config of the WebSocket JSON-RPC server
+type WebSocketConfig struct {
+	Addr    string
+	Origins []string // the allowed origins, * for any, Default localhost
+}
+
+// AddressActivityFilter is the filter of the newchainAddressActivity subscription
+type AddressActivityFilter struct {
+	Addresses      []string `json:"addresses"`      // the hex or NEW addresses, empty for all
+	Confirmations  uint64   `json:"confirmations"`  // the min confirmations of the confirmed events
+	IncludePending bool     `json:"includePending"` // include the pending events
+}
+
+// AddressActivityAPI is the eth namespace of the WebSocket JSON-RPC server, with the custom
+// subscription types of eth_subscribe. It is exported as required by the rpc server.
+type AddressActivityAPI struct {
+	hub *Hub
+}
+
+// NewchainAddressActivity is the subscription eth_subscribe("newchainAddressActivity", filter),
+// which pushes the TransferTx of the events of the hub selected by the filter.
+func (s *AddressActivityAPI) NewchainAddressActivity(ctx context.Context, filter *AddressActivityFilter) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	if filter == nil {
+		filter = &AddressActivityFilter{}
+	}
+	addresses, err := parseAddresses(filter.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.hub.Subscribe(SubscribeFilter{
+		Addresses:      addresses,
+		Confirmations:  filter.Confirmations,
+		IncludePending: filter.IncludePending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if err := notifier.Notify(rpcSub.ID, e.Tx); err != nil {
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// NewWebSocketHandler returns the WebSocket JSON-RPC handler with the subscriptions on the hub
+func NewWebSocketHandler(hub *Hub, origins []string) (http.Handler, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &AddressActivityAPI{hub: hub}); err != nil {
+		return nil, err
+	}
+
+	return server.WebsocketHandler(origins), nil
+}
+
+// ServeWebSocket listens on the address of the config, and serves the WebSocket
+// JSON-RPC server in background
+func ServeWebSocket(c *WebSocketConfig, hub *Hub, logger *log.Logger) (*http.Server, error) {
+	handler, err := NewWebSocketHandler(hub, c.Origins)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{Handler: handler}
+	go func() {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorln(err)
+		}
+	}()
+	logger.Infof("WebSocket server listening on %s", l.Addr())
+
+	return s, nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/newtonproject/newchain-notify/address"
+)
+
+func TestWebSocketAddressActivity(t *testing.T) {
+	hub := NewHub("newchain/", 0)
+	handler, err := NewWebSocketHandler(hub, []string{"*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	c, err := rpc.DialWebsocket(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ch := make(chan json.RawMessage, 1)
+	filter := &AddressActivityFilter{Addresses: []string{address.ToNEW(common.HexToAddress(hubTo), 1012)}, Confirmations: 4}
+	sub, err := c.EthSubscribe(context.Background(), ch, "newchainAddressActivity", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	topic := "newchain/" + hubTo[2:]
+	hubPublish(t, hub, topic+"/0", hubPayload(common.BytesToHash([]byte{1}).Hex(), -1))
+	payload := hubPayload(common.BytesToHash([]byte{1}).Hex(), 1)
+	hubPublish(t, hub, topic+"/4", payload)
+
+	select {
+	case tx := <-ch:
+		if string(tx) != payload {
+			t.Errorf("payload mismatch: have %s, want %s", tx, payload)
+		}
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the notification")
+	}
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockWindow keeps the latest limit blocks and indexes the transactions in them by hash
+type blockWindow struct {
+	limit  int
+	blocks []*types.Block
+	index  map[common.Hash]*types.Block
+}
+
+func newBlockWindow(limit int) *blockWindow {
+	if limit < 1 {
+		limit = 1
+	}
+	return &blockWindow{
+		limit: limit,
+		index: make(map[common.Hash]*types.Block),
+	}
+}
+
+// Add appends the block to the window and evicts the oldest blocks out of limit
+func (w *blockWindow) Add(block *types.Block) {
+	w.blocks = append(w.blocks, block)
+	for _, tx := range block.Transactions() {
+		w.index[tx.Hash()] = block
+	}
+
+	for len(w.blocks) > w.limit {
+		old := w.blocks[0]
+		w.blocks[0] = nil
+		w.blocks = w.blocks[1:]
+		for _, tx := range old.Transactions() {
+			// the tx may be indexed by a later block with the same number
+			if w.index[tx.Hash()] == old {
+				delete(w.index, tx.Hash())
+			}
+		}
+	}
+}
+
+// Lookup returns the block which include the transaction, or nil if not found in the window
+func (w *blockWindow) Lookup(hash common.Hash) *types.Block {
+	return w.index[hash]
+}
+
+// Len returns the number of the blocks in the window
+func (w *blockWindow) Len() int {
+	return len(w.blocks)
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func newTestBlock(number uint64, txCount int) *types.Block {
+	to := common.HexToAddress("0x97549e368acafdcae786bb93d98379f1d1561a29")
+	txs := make([]*types.Transaction, txCount)
+	for i := range txs {
+		txs[i] = types.NewTransaction(number<<32|uint64(i), to, big.NewInt(1), 21000, big.NewInt(1), nil)
+	}
+	header := &types.Header{Number: new(big.Int).SetUint64(number)}
+
+	return types.NewBlock(header, txs, nil, nil)
+}
+
+func TestBlockWindow(t *testing.T) {
+	window := newBlockWindow(3)
+	var blocks []*types.Block
+	for i := uint64(0); i < 5; i++ {
+		block := newTestBlock(i, 2)
+		blocks = append(blocks, block)
+		window.Add(block)
+	}
+
+	if window.Len() != 3 {
+		t.Errorf("window size mismatch: have %d, want %d", window.Len(), 3)
+	}
+	for i, block := range blocks {
+		for _, tx := range block.Transactions() {
+			got := window.Lookup(tx.Hash())
+			if i < 2 && got != nil {
+				t.Errorf("evicted tx %s found in block %d", tx.Hash().String(), got.NumberU64())
+			}
+			if i >= 2 && got != block {
+				t.Errorf("tx %s not found in block %d", tx.Hash().String(), block.NumberU64())
+			}
+		}
+	}
+}
+
+// benchmarkWindow builds the window of runBlockCheck and the hashes of the
+// queued transactions, half of which are included in the window.
+func benchmarkWindow(queueSize, windowSize, txsPerBlock int) (*blockWindow, []*types.Block, []common.Hash) {
+	window := newBlockWindow(windowSize)
+	var blocks []*types.Block
+	for i := 0; i < windowSize; i++ {
+		block := newTestBlock(uint64(i), txsPerBlock)
+		blocks = append(blocks, block)
+		window.Add(block)
+	}
+
+	hashes := make([]common.Hash, queueSize)
+	for i := range hashes {
+		if i%2 == 0 {
+			txs := blocks[i%windowSize].Transactions()
+			hashes[i] = txs[i%txsPerBlock].Hash()
+		} else {
+			hashes[i] = common.BigToHash(big.NewInt(int64(i)))
+		}
+	}
+
+	return window, blocks, hashes
+}
+
+// BenchmarkBlockCheckScan checks the queue by scanning all transactions of all blocks.
+func BenchmarkBlockCheckScan(b *testing.B) {
+	_, blocks, hashes := benchmarkWindow(1000, 14, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, hash := range hashes {
+		scan:
+			for _, block := range blocks {
+				for _, tx := range block.Transactions() {
+					if tx.Hash() == hash {
+						break scan
+					}
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkBlockCheckLookup checks the queue by the hash index of the window.
+func BenchmarkBlockCheckLookup(b *testing.B) {
+	window, _, hashes := benchmarkWindow(1000, 14, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, hash := range hashes {
+			window.Lookup(hash)
+		}
+	}
+}
+
+func BenchmarkBlockWindowAdd(b *testing.B) {
+	blocks := make([]*types.Block, 64)
+	for i := range blocks {
+		blocks[i] = newTestBlock(uint64(i), 200)
+	}
+	window := newBlockWindow(14)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		window.Add(blocks[i%len(blocks)])
+	}
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrFull is returned when push into a full concurrent queue with the Reject policy.
+	ErrFull = errors.New("queue is full")
+	// ErrClosed is returned when push into a closed concurrent queue, or pop from
+	// a closed and drained one.
+	ErrClosed = errors.New("queue is closed")
+)
+
+// Policy decides what Push does when a concurrent queue is at its capacity.
+type Policy int
+
+const (
+	// Block waits until there is room in the queue.
+	Block Policy = iota
+	// DropOldest pops out the first element to make room.
+	DropOldest
+	// Reject returns ErrFull immediately.
+	Reject
+)
+
+// First in, first out data structure safe for concurrent use, with blocking
+// and context-aware operations. It is backed by the same circular slice of
+// blocks as Queue.
+type Concurrent struct {
+	lock     sync.Mutex
+	queue    *Queue
+	capacity int
+	policy   Policy
+	closed   bool
+	changed  chan struct{} // closed and replaced when the queue changes with waiters
+	waiters  int           // the number of Push and Pop waiting for changed
+	done     chan struct{} // closed by Close
+	dropped  uint64
+}
+
+// Creates a new, empty concurrent queue. A capacity of zero or less means the
+// queue is unbounded and the policy is never used.
+func NewConcurrent(capacity int, policy Policy) *Concurrent {
+	return &Concurrent{
+		queue:    New(),
+		capacity: capacity,
+		policy:   policy,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// broadcast wakes up all the waiting Push and Pop if any, the lock must be held.
+func (q *Concurrent) broadcast() {
+	if q.waiters == 0 {
+		return
+	}
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// wait releases the lock till the queue changes or the context is done, the lock
+// must be held, and is held again when it returns.
+func (q *Concurrent) wait(ctx context.Context) error {
+	changed := q.changed
+	q.waiters++
+	q.lock.Unlock()
+
+	var err error
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.lock.Lock()
+	q.waiters--
+	return err
+}
+
+// Pushes a new element into the queue. If the queue is full, it waits for room,
+// drops the oldest element or returns ErrFull according to the policy.
+func (q *Concurrent) Push(ctx context.Context, data interface{}) error {
+	q.lock.Lock()
+	for {
+		if q.closed {
+			q.lock.Unlock()
+			return ErrClosed
+		}
+		if q.capacity <= 0 || q.queue.Size() < q.capacity {
+			break
+		}
+		if q.policy == DropOldest {
+			q.queue.Pop()
+			q.dropped++
+			break
+		}
+		if q.policy == Reject {
+			q.lock.Unlock()
+			return ErrFull
+		}
+
+		if err := q.wait(ctx); err != nil {
+			q.lock.Unlock()
+			return err
+		}
+	}
+
+	q.queue.Push(data)
+	q.broadcast()
+	q.lock.Unlock()
+
+	return nil
+}
+
+// Pops out the first element, waiting until there is one. The elements left
+// after Close can still be popped, then ErrClosed is returned.
+func (q *Concurrent) Pop(ctx context.Context) (interface{}, error) {
+	q.lock.Lock()
+	for q.queue.Empty() {
+		if q.closed {
+			q.lock.Unlock()
+			return nil, ErrClosed
+		}
+
+		if err := q.wait(ctx); err != nil {
+			q.lock.Unlock()
+			return nil, err
+		}
+	}
+
+	data := q.queue.Pop()
+	q.broadcast()
+	q.lock.Unlock()
+
+	return data, nil
+}
+
+// Pops out the first element if there is one, without waiting.
+func (q *Concurrent) TryPop() (interface{}, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.queue.Empty() {
+		return nil, false
+	}
+	data := q.queue.Pop()
+	q.broadcast()
+
+	return data, true
+}
+
+// Returns the number of elements in the queue.
+func (q *Concurrent) Size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.queue.Size()
+}
+
+// Checks whether the queue is empty.
+func (q *Concurrent) Empty() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.queue.Empty()
+}
+
+// Returns the number of elements dropped by the DropOldest policy.
+func (q *Concurrent) Dropped() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.dropped
+}
+
+// Closes the queue, the waiting and later Push return ErrClosed, and Pop
+// returns ErrClosed once the queue is drained.
+func (q *Concurrent) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.broadcast()
+}
+
+// Returns a channel which is closed when the queue is closed.
+func (q *Concurrent) Done() <-chan struct{} {
+	return q.done
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrent(t *testing.T) {
+	queue := NewConcurrent(blockSize/2, Block)
+	ctx := context.Background()
+
+	producers, count := 4, 4*blockSize
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				if err := queue.Push(ctx, p*count+i); err != nil {
+					t.Errorf("push failed: %v", err)
+					return
+				}
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		queue.Close()
+	}()
+
+	// Pop from several consumers, every element must be popped exactly once
+	var lock sync.Mutex
+	seen := make(map[int]bool)
+	outs := 0
+	var cwg sync.WaitGroup
+	for c := 0; c < 3; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				data, err := queue.Pop(ctx)
+				if err == ErrClosed {
+					return
+				}
+				if err != nil {
+					t.Errorf("pop failed: %v", err)
+					return
+				}
+				if queue.Size() > blockSize/2 {
+					t.Errorf("size over capacity: %v", queue.Size())
+				}
+				lock.Lock()
+				if seen[data.(int)] {
+					t.Errorf("duplicate pop: %v", data)
+				}
+				seen[data.(int)] = true
+				outs++
+				lock.Unlock()
+			}
+		}()
+	}
+	cwg.Wait()
+
+	if outs != producers*count {
+		t.Errorf("pop count mismatch: have %v, want %v.", outs, producers*count)
+	}
+	if err := queue.Push(ctx, 0); err != ErrClosed {
+		t.Errorf("push to closed queue: have %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestConcurrentOrder(t *testing.T) {
+	queue := NewConcurrent(0, Block)
+	ctx := context.Background()
+	size := 4 * blockSize
+
+	go func() {
+		for i := 0; i < size; i++ {
+			queue.Push(ctx, i)
+		}
+		queue.Close()
+	}()
+	for i := 0; ; i++ {
+		data, err := queue.Pop(ctx)
+		if err == ErrClosed {
+			if i != size {
+				t.Errorf("pop count mismatch: have %v, want %v.", i, size)
+			}
+			break
+		}
+		if data != i {
+			t.Errorf("push/pop mismatch: have %v, want %v.", data, i)
+		}
+	}
+	select {
+	case <-queue.Done():
+	default:
+		t.Errorf("done not closed after close")
+	}
+}
+
+func TestConcurrentPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	reject := NewConcurrent(2, Reject)
+	reject.Push(ctx, 0)
+	reject.Push(ctx, 1)
+	if err := reject.Push(ctx, 2); err != ErrFull {
+		t.Errorf("push to full queue: have %v, want %v", err, ErrFull)
+	}
+
+	drop := NewConcurrent(2, DropOldest)
+	for i := 0; i < 5; i++ {
+		if err := drop.Push(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if drop.Dropped() != 3 {
+		t.Errorf("dropped mismatch: have %v, want %v", drop.Dropped(), 3)
+	}
+	for i := 3; i < 5; i++ {
+		if data, ok := drop.TryPop(); !ok || data != i {
+			t.Errorf("drop oldest mismatch: have %v, want %v", data, i)
+		}
+	}
+	if _, ok := drop.TryPop(); ok {
+		t.Errorf("try pop from empty queue succeeded")
+	}
+
+	block := NewConcurrent(1, Block)
+	block.Push(ctx, 0)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := block.Push(timeout, 1); err != context.DeadlineExceeded {
+		t.Errorf("push to full queue: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		block.TryPop()
+	}()
+	if err := block.Push(ctx, 2); err != nil {
+		t.Errorf("push after pop: %v", err)
+	}
+}
+
+func TestConcurrentPopCancel(t *testing.T) {
+	queue := NewConcurrent(0, Block)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := queue.Pop(ctx); err != context.Canceled {
+		t.Errorf("pop from empty queue: have %v, want %v", err, context.Canceled)
+	}
+
+	queue.Push(context.Background(), 1)
+	queue.Close()
+	if data, err := queue.Pop(context.Background()); err != nil || data != 1 {
+		t.Errorf("pop after close: have %v %v, want %v", data, err, 1)
+	}
+	if _, err := queue.Pop(context.Background()); err != ErrClosed {
+		t.Errorf("pop from drained queue: have %v, want %v", err, ErrClosed)
+	}
+}
+
+func BenchmarkConcurrent(b *testing.B) {
+	queue := NewConcurrent(blockSize, Block)
+	ctx := context.Background()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			queue.Push(ctx, i)
+		}
+		queue.Close()
+	}()
+	for {
+		if _, err := queue.Pop(ctx); err != nil {
+			break
+		}
+	}
+}
+
+func BenchmarkConcurrentPush(b *testing.B) {
+	queue := NewConcurrent(0, Block)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		queue.Push(ctx, i)
+	}
+}
+
+func BenchmarkConcurrentPop(b *testing.B) {
+	queue := NewConcurrent(0, Block)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		queue.Push(ctx, i)
+	}
+	b.ResetTimer()
+	for !queue.Empty() {
+		queue.Pop(ctx)
+	}
+}
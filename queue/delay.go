@@ -0,0 +1,483 @@
+package queue
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	// delayPrefix keeps the delay elements apart from the ones of DurableQueue
+	delayPrefix = []byte("d")
+	// corruptPrefix keeps the delay elements failed to decode, moved aside at open
+	corruptPrefix = []byte("c")
+)
+
+// DelayItem is an element of the delay queue with its due number.
+type DelayItem struct {
+	ID   uint64
+	Due  uint64
+	Data interface{}
+}
+
+// delayEntry is the element in the heap with its position, so that it can be removed
+type delayEntry struct {
+	DelayItem
+	index int
+}
+
+type delayHeap []*delayEntry
+
+func (h delayHeap) Len() int { return len(h) }
+func (h delayHeap) Less(i, j int) bool {
+	if h[i].Due != h[j].Due {
+		return h[i].Due < h[j].Due
+	}
+	return h[i].ID < h[j].ID
+}
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *delayHeap) Push(x interface{}) {
+	entry := x.(*delayEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// Delay queue holds the elements until their due number, such as a block number
+// or a unix time, is reached. The elements with the same due number are released
+// in the order they are pushed. It is not safe for concurrent use.
+type Delay struct {
+	items  delayHeap
+	index  map[uint64]*delayEntry
+	nextID uint64
+}
+
+// Creates a new, empty delay queue.
+func NewDelay() *Delay {
+	return &Delay{index: make(map[uint64]*delayEntry)}
+}
+
+// Pushes a new element due at the number, the returned ID can be used to remove it.
+func (q *Delay) Push(due uint64, data interface{}) uint64 {
+	id := q.nextID
+	q.push(DelayItem{ID: id, Due: due, Data: data})
+	return id
+}
+
+func (q *Delay) push(item DelayItem) {
+	if item.ID >= q.nextID {
+		q.nextID = item.ID + 1
+	}
+	entry := &delayEntry{DelayItem: item}
+	q.index[item.ID] = entry
+	heap.Push(&q.items, entry)
+}
+
+// Removes the element by the ID, returns false if it is not in the queue.
+func (q *Delay) Remove(id uint64) bool {
+	entry, ok := q.index[id]
+	if !ok {
+		return false
+	}
+	delete(q.index, id)
+	heap.Remove(&q.items, entry.index)
+	return true
+}
+
+// Pops out all the elements due at or before the head, in the due order.
+func (q *Delay) Release(head uint64) []DelayItem {
+	var items []DelayItem
+	for len(q.items) > 0 && q.items[0].Due <= head {
+		entry := heap.Pop(&q.items).(*delayEntry)
+		delete(q.index, entry.ID)
+		items = append(items, entry.DelayItem)
+	}
+	return items
+}
+
+// Returns the earliest due number, false if the queue is empty.
+func (q *Delay) Next() (uint64, bool) {
+	if len(q.items) == 0 {
+		return 0, false
+	}
+	return q.items[0].Due, true
+}
+
+// Returns all the elements in the queue without removing them, in no particular order.
+func (q *Delay) Items() []DelayItem {
+	items := make([]DelayItem, 0, len(q.items))
+	for _, entry := range q.items {
+		items = append(items, entry.DelayItem)
+	}
+	return items
+}
+
+// Checks whether the queue is empty.
+func (q *Delay) Empty() bool {
+	return len(q.items) == 0
+}
+
+// Returns the number of elements in the queue.
+func (q *Delay) Size() int {
+	return len(q.items)
+}
+
+// DurableDelay is a delay queue persisted in a leveldb database, the elements
+// and their IDs are kept across restarts. It is safe for concurrent use.
+type DurableDelay struct {
+	lock    sync.Mutex
+	delay   *Delay
+	leased  map[uint64]DelayItem // released by Lease, but still in the database
+	db      *leveldb.DB
+	codec   Codec
+	corrupt int
+}
+
+// Opens the durable delay queue in the path, the elements pushed before are restored.
+// If the path is empty, the queue is kept in memory only.
+//
+// The elements failed to decode are moved aside instead of failing the open, see
+// Corrupted. The elements of a DurableQueue in the same database, such as the ones
+// kept by the versions before the delay queue, are moved into the delay queue due
+// at 0 in their order, so the codec should decode them too.
+func OpenDurableDelay(path string, codec Codec) (*DurableDelay, error) {
+	if codec == nil {
+		return nil, errors.New("queue codec can not be nil")
+	}
+
+	var (
+		db  *leveldb.DB
+		err error
+	)
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := &DurableDelay{delay: NewDelay(), leased: make(map[uint64]DelayItem), db: db, codec: codec}
+	if err := q.restore(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := q.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// restore loads the elements, and moves aside the ones failed to decode
+func (q *DurableDelay) restore() error {
+	batch := new(leveldb.Batch)
+	iter := q.db.NewIterator(util.BytesPrefix(delayPrefix), nil)
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if len(key) != len(delayPrefix)+8 {
+			continue
+		}
+		id := binary.BigEndian.Uint64(key[len(delayPrefix):])
+		var data interface{}
+		err := errors.New("delay element too short")
+		if len(value) >= 8 {
+			data, err = q.codec.Decode(value[8:])
+		}
+		if err != nil {
+			batch.Delete(key)
+			batch.Put(prefixKey(corruptPrefix, id), value)
+			q.corrupt++
+			// keep the ID from being reused
+			if id >= q.delay.nextID {
+				q.delay.nextID = id + 1
+			}
+			continue
+		}
+		q.delay.push(DelayItem{
+			ID:   id,
+			Due:  binary.BigEndian.Uint64(value[:8]),
+			Data: data,
+		})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return q.db.Write(batch, nil)
+}
+
+// migrate moves the elements of DurableQueue in the database into the delay queue due at 0
+func (q *DurableDelay) migrate() error {
+	var (
+		items []DelayItem
+		moved uint64
+		base  = q.delay.nextID
+		batch = new(leveldb.Batch)
+	)
+	iter := q.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if len(key) != 8 {
+			continue
+		}
+		id := base + moved
+		moved++
+		batch.Delete(key)
+		data, err := q.codec.Decode(value)
+		if err != nil {
+			batch.Put(prefixKey(corruptPrefix, id), value)
+			q.corrupt++
+			continue
+		}
+		b := make([]byte, 8+len(value))
+		copy(b[8:], value)
+		batch.Put(delayKey(id), b)
+		items = append(items, DelayItem{ID: id, Data: data})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if moved == 0 {
+		return nil
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		q.delay.push(item)
+	}
+	q.delay.nextID = base + moved
+	return nil
+}
+
+func delayKey(id uint64) []byte {
+	return prefixKey(delayPrefix, id)
+}
+
+func prefixKey(prefix []byte, id uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], id)
+	return key
+}
+
+// Returns the number of the elements failed to decode at open, they are moved aside
+// in the database and never released.
+func (q *DurableDelay) Corrupted() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.corrupt
+}
+
+// Pushes a new element due at the number, the returned ID can be used to remove it.
+func (q *DurableDelay) Push(due uint64, data interface{}) (uint64, error) {
+	b, err := q.codec.Encode(data)
+	if err != nil {
+		return 0, err
+	}
+	value := make([]byte, 8+len(b))
+	binary.BigEndian.PutUint64(value, due)
+	copy(value[8:], b)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	id := q.delay.nextID
+	if err := q.db.Put(delayKey(id), value, nil); err != nil {
+		return 0, err
+	}
+	q.delay.push(DelayItem{ID: id, Due: due, Data: data})
+
+	return id, nil
+}
+
+// Removes the element by the ID, returns false if it is not in the queue.
+func (q *DurableDelay) Remove(id uint64) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.delay.index[id]; !ok {
+		return false, nil
+	}
+	if err := q.db.Delete(delayKey(id), nil); err != nil {
+		return false, err
+	}
+
+	return q.delay.Remove(id), nil
+}
+
+// Pops out all the elements due at or before the head, in the due order.
+func (q *DurableDelay) Release(head uint64) ([]DelayItem, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if due, ok := q.delay.Next(); !ok || due > head {
+		return nil, nil
+	}
+	items := q.delay.Release(head)
+	batch := new(leveldb.Batch)
+	for _, item := range items {
+		batch.Delete(delayKey(item.ID))
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		// put them back so that they are released again
+		for _, item := range items {
+			q.delay.push(item)
+		}
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Pops out all the elements due at or before the head like Release, but keeps them in
+// the database until they are removed by a DelayBatch, so that they are released again
+// after a restart if the work on them is never done.
+func (q *DurableDelay) Lease(head uint64) []DelayItem {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	items := q.delay.Release(head)
+	for _, item := range items {
+		q.leased[item.ID] = item
+	}
+	return items
+}
+
+// DelayBatch collects the pushes and the removes of the durable delay queue, and
+// writes them in one leveldb batch, so that either all or none of them are done.
+type DelayBatch struct {
+	q       *DurableDelay
+	batch   leveldb.Batch
+	pushed  []DelayItem
+	removed []uint64
+}
+
+// Creates a new, empty batch of the queue.
+func (q *DurableDelay) NewBatch() *DelayBatch {
+	return &DelayBatch{q: q}
+}
+
+// Pushes a new element due at the number in the batch, the returned ID is the one
+// of the element once the batch is written.
+func (b *DelayBatch) Push(due uint64, data interface{}) (uint64, error) {
+	v, err := b.q.codec.Encode(data)
+	if err != nil {
+		return 0, err
+	}
+	value := make([]byte, 8+len(v))
+	binary.BigEndian.PutUint64(value, due)
+	copy(value[8:], v)
+
+	b.q.lock.Lock()
+	id := b.q.delay.nextID
+	b.q.delay.nextID++
+	b.q.lock.Unlock()
+
+	b.batch.Put(delayKey(id), value)
+	b.pushed = append(b.pushed, DelayItem{ID: id, Due: due, Data: data})
+	return id, nil
+}
+
+// Removes the queued or leased element by the ID in the batch.
+func (b *DelayBatch) Remove(id uint64) {
+	b.batch.Delete(delayKey(id))
+	b.removed = append(b.removed, id)
+}
+
+// Returns the number of the pushes and the removes in the batch.
+func (b *DelayBatch) Len() int {
+	return b.batch.Len()
+}
+
+// Writes the batch. If it fails, none of the batch is done, and the leased elements
+// removed in the batch are put back to be released again.
+func (b *DelayBatch) Write() error {
+	q := b.q
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := q.db.Write(&b.batch, nil); err != nil {
+		for _, id := range b.removed {
+			if item, ok := q.leased[id]; ok {
+				delete(q.leased, id)
+				q.delay.push(item)
+			}
+		}
+		return err
+	}
+
+	for _, id := range b.removed {
+		if _, ok := q.leased[id]; ok {
+			delete(q.leased, id)
+			continue
+		}
+		q.delay.Remove(id)
+	}
+	for _, item := range b.pushed {
+		q.delay.push(item)
+	}
+	return nil
+}
+
+// Returns the earliest due number, false if the queue is empty.
+func (q *DurableDelay) Next() (uint64, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.delay.Next()
+}
+
+// Returns all the elements in the queue without removing them, in no particular order.
+func (q *DurableDelay) Items() []DelayItem {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.delay.Items()
+}
+
+// Checks whether the queue is empty.
+func (q *DurableDelay) Empty() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.delay.Empty()
+}
+
+// Returns the number of elements in the queue.
+func (q *DurableDelay) Size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.delay.Size()
+}
+
+// Closes the database of the queue.
+func (q *DurableDelay) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.db.Close()
+}
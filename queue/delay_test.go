@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDelay(t *testing.T) {
+	queue := NewDelay()
+	if _, ok := queue.Next(); ok {
+		t.Errorf("next of empty queue succeeded")
+	}
+
+	// push in reverse, the elements with the same due keep the push order
+	size := 2 * blockSize
+	ids := make([]uint64, size)
+	for i := size - 1; i >= 0; i-- {
+		ids[i] = queue.Push(uint64(i/2), i)
+	}
+	if due, ok := queue.Next(); !ok || due != 0 {
+		t.Errorf("next mismatch: have %v, want %v.", due, 0)
+	}
+	if !queue.Remove(ids[4]) || queue.Remove(ids[4]) {
+		t.Errorf("remove mismatch")
+	}
+
+	if items := queue.Release(0); len(items) != 2 || items[0].Data != 1 || items[1].Data != 0 {
+		t.Errorf("release mismatch: have %v", items)
+	}
+	items := queue.Release(uint64(size))
+	if len(items) != size-3 {
+		t.Fatalf("release size mismatch: have %v, want %v.", len(items), size-3)
+	}
+	for i := 1; i < len(items); i++ {
+		if items[i-1].Due > items[i].Due {
+			t.Errorf("release out of order: %v after %v", items[i], items[i-1])
+		}
+	}
+	for _, item := range items {
+		if item.Data == 4 {
+			t.Errorf("removed element released")
+		}
+	}
+	if !queue.Empty() {
+		t.Errorf("queue not empty after release all: %v", queue.Size())
+	}
+}
+
+func TestDurableDelayRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := OpenDurableDelay(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		queue.Push(uint64(10-i), i)
+	}
+	if items, err := queue.Release(1); err != nil || len(items) != 1 || items[0].Data != 9 {
+		t.Errorf("release mismatch: have %v %v", items, err)
+	}
+	if ok, err := queue.Remove(0); err != nil || !ok {
+		t.Errorf("remove failed: %v %v", ok, err)
+	}
+	queue.Close()
+
+	queue, err = OpenDurableDelay(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if queue.Size() != 8 {
+		t.Errorf("size mismatch after restore: have %v, want %v.", queue.Size(), 8)
+	}
+	id, err := queue.Push(5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id <= 8 {
+		t.Errorf("id of queued element reused after restore: %v", id)
+	}
+
+	items, err := queue.Release(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{8, 7, 6, 5, 10}
+	if len(items) != len(want) {
+		t.Fatalf("release size mismatch: have %v, want %v.", len(items), len(want))
+	}
+	for i, item := range items {
+		if item.Data != want[i] {
+			t.Errorf("restore mismatch: have %v, want %v.", item.Data, want[i])
+		}
+	}
+}
+
+// rawCodec encodes the strings as they are, so that they fail to decode as int
+type rawCodec struct {
+	intCodec
+}
+
+func (c rawCodec) Encode(data interface{}) ([]byte, error) {
+	if s, ok := data.(string); ok {
+		return []byte(s), nil
+	}
+	return c.intCodec.Encode(data)
+}
+
+func TestDurableDelayLease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := OpenDurableDelay(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		queue.Push(uint64(i), i)
+	}
+	if items := queue.Lease(2); len(items) != 2 || queue.Size() != 1 {
+		t.Fatalf("lease mismatch: have %v, size %v", items, queue.Size())
+	}
+	queue.Close()
+
+	// the leased elements are released again after a restart
+	queue, err = OpenDurableDelay(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Size() != 3 {
+		t.Fatalf("size mismatch after restart: have %v, want %v.", queue.Size(), 3)
+	}
+	items := queue.Lease(2)
+	if len(items) != 2 || items[0].Data != 1 || items[1].Data != 2 {
+		t.Fatalf("lease mismatch: have %v", items)
+	}
+	batch := queue.NewBatch()
+	batch.Remove(items[0].ID)
+	batch.Remove(items[1].ID)
+	if _, err := batch.Push(5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if queue.Size() != 2 {
+		t.Errorf("size mismatch after write: have %v, want %v.", queue.Size(), 2)
+	}
+	queue.Close()
+
+	queue, err = OpenDurableDelay(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items = queue.Lease(5)
+	if len(items) != 2 || items[0].Data != 3 || items[1].Data != 10 {
+		t.Fatalf("restore mismatch after write: have %v", items)
+	}
+
+	// the leased elements are put back if the batch fails
+	queue.Close()
+	batch = queue.NewBatch()
+	batch.Remove(items[0].ID)
+	if err := batch.Write(); err == nil {
+		t.Fatal("write to closed queue succeeded")
+	}
+	if queue.Size() != 1 {
+		t.Errorf("size mismatch after failed write: have %v, want %v.", queue.Size(), 1)
+	}
+}
+
+func TestDurableDelayCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := OpenDurableDelay(dir, rawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Push(1, 1)
+	queue.Push(2, "bad")
+	queue.Push(3, 3)
+	queue.Close()
+
+	// the element failed to decode is moved aside instead of failing the open
+	for i, corrupted := range []int{1, 0} {
+		queue, err = OpenDurableDelay(dir, rawCodec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queue.Corrupted() != corrupted || queue.Size() != 2+i {
+			t.Errorf("%d: restore mismatch: corrupted %v, size %v", i, queue.Corrupted(), queue.Size())
+		}
+		if id, _ := queue.Push(4, 4); id <= 2 {
+			t.Errorf("%d: id of corrupted element reused: %v", i, id)
+		}
+		queue.Close()
+	}
+}
+
+func TestDurableDelayMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	durable, err := OpenDurable(dir, rawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		durable.Push(i)
+	}
+	durable.Push("bad")
+	durable.Push(4)
+	durable.Pop()
+	durable.Close()
+
+	// the elements of DurableQueue are due at 0 in their order
+	queue, err := OpenDurableDelay(dir, rawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Corrupted() != 1 || queue.Size() != 4 {
+		t.Errorf("migrate mismatch: corrupted %v, size %v", queue.Corrupted(), queue.Size())
+	}
+	queue.Close()
+
+	queue, err = OpenDurableDelay(dir, rawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	items, err := queue.Release(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 2, 3, 4}
+	if len(items) != len(want) {
+		t.Fatalf("migrate size mismatch: have %v, want %v.", len(items), len(want))
+	}
+	for i, item := range items {
+		if item.Data != want[i] {
+			t.Errorf("migrate mismatch: have %v, want %v.", item.Data, want[i])
+		}
+	}
+}
+
+func BenchmarkDelay(b *testing.B) {
+	queue := NewDelay()
+	for i := 0; i < b.N; i++ {
+		queue.Push(uint64(i%blockSize), i)
+		if i%blockSize == blockSize-1 {
+			queue.Release(uint64(i))
+		}
+	}
+}
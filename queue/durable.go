@@ -0,0 +1,234 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrEmpty is returned when pop or peek from an empty durable queue.
+var ErrEmpty = errors.New("queue is empty")
+
+// quarantinePrefix keeps the elements of the durable queue failed to decode, moved
+// aside by Pop and Peek, apart from the elements keyed by their 8 bytes sequence.
+var quarantinePrefix = []byte("q")
+
+// Codec encodes the elements of the durable queue to bytes and decodes them back.
+type Codec interface {
+	Encode(data interface{}) ([]byte, error)
+	Decode(b []byte) (interface{}, error)
+}
+
+// First in, first out data structure persisted in a leveldb database, the
+// elements are kept across restarts. It is safe for concurrent use.
+//
+// The elements failed to decode are moved aside instead of returned, so they
+// never block the queue, see Corrupted.
+type DurableQueue struct {
+	lock    sync.Mutex
+	db      *leveldb.DB
+	codec   Codec
+	corrupt int
+
+	headSeq uint64 // the key of the first element
+	tailSeq uint64 // the key of the next pushed element
+}
+
+// Opens the durable queue in the path, the elements pushed before are restored.
+// If the path is empty, the queue is kept in memory only.
+func OpenDurable(path string, codec Codec) (*DurableQueue, error) {
+	if codec == nil {
+		return nil, errors.New("queue codec can not be nil")
+	}
+
+	var (
+		db  *leveldb.DB
+		err error
+	)
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := &DurableQueue{db: db, codec: codec}
+	iter := db.NewIterator(nil, nil)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if len(iter.Key()) == 8 {
+			q.headSeq = binary.BigEndian.Uint64(iter.Key())
+			break
+		}
+	}
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		if len(iter.Key()) == 8 {
+			q.tailSeq = binary.BigEndian.Uint64(iter.Key()) + 1
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Pushes a new element into the queue.
+func (q *DurableQueue) Push(data interface{}) error {
+	b, err := q.codec.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := q.db.Put(seqKey(q.tailSeq), b, nil); err != nil {
+		return err
+	}
+	q.tailSeq++
+
+	return nil
+}
+
+// Pops out an element from the queue, ErrEmpty is returned if the queue is empty.
+func (q *DurableQueue) Pop() (interface{}, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	items, err := q.peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+	if err := q.db.Delete(seqKey(q.headSeq), nil); err != nil {
+		return nil, err
+	}
+	q.headSeq++
+
+	return items[0], nil
+}
+
+// Returns the first element in the queue, ErrEmpty is returned if the queue is empty.
+func (q *DurableQueue) Front() (interface{}, error) {
+	items, err := q.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return items[0], nil
+}
+
+// Returns up to the first n elements in the queue without removing them. It stops
+// before the element failed to decode, which is moved aside once it is the first.
+func (q *DurableQueue) Peek(n int) ([]interface{}, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.peek(n)
+}
+
+// peek returns up to the first n elements, the lock must be held. The elements failed
+// to decode are moved aside only at the head, so the sequences are kept contiguous.
+func (q *DurableQueue) peek(n int) ([]interface{}, error) {
+	items := make([]interface{}, 0, n)
+	iter := q.db.NewIterator(&util.Range{Start: seqKey(q.headSeq), Limit: seqKey(q.tailSeq)}, nil)
+	defer iter.Release()
+	for len(items) < n && iter.Next() {
+		data, err := q.codec.Decode(iter.Value())
+		if err == nil {
+			items = append(items, data)
+			continue
+		}
+		if len(items) > 0 {
+			break
+		}
+		if err := q.quarantine(q.headSeq, iter.Value()); err != nil {
+			return nil, err
+		}
+		q.headSeq++
+	}
+
+	return items, iter.Error()
+}
+
+// quarantine moves the element failed to decode aside
+func (q *DurableQueue) quarantine(seq uint64, value []byte) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(seqKey(seq))
+	batch.Put(append(append([]byte{}, quarantinePrefix...), seqKey(seq)...), value)
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.corrupt++
+	return nil
+}
+
+// Returns the number of the elements failed to decode, which are moved aside
+// in the database, so they can be inspected and recovered.
+func (q *DurableQueue) Corrupted() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.corrupt
+}
+
+// Checks whether the queue is empty.
+func (q *DurableQueue) Empty() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.headSeq == q.tailSeq
+}
+
+// Returns the number of elements in the queue.
+func (q *DurableQueue) Size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return int(q.tailSeq - q.headSeq)
+}
+
+// Clears out the contents of the queue.
+func (q *DurableQueue) Reset() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	batch := new(leveldb.Batch)
+	for seq := q.headSeq; seq < q.tailSeq; seq++ {
+		batch.Delete(seqKey(seq))
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.headSeq, q.tailSeq = 0, 0
+
+	return nil
+}
+
+// Closes the database of the queue.
+func (q *DurableQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.db.Close()
+}
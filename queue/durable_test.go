@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+type intCodec struct{}
+
+func (intCodec) Encode(data interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(data.(int))), nil
+}
+
+func (intCodec) Decode(b []byte) (interface{}, error) {
+	return strconv.Atoi(string(b))
+}
+
+func TestDurableQueue(t *testing.T) {
+	queue, err := OpenDurable("", intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	if _, err := queue.Pop(); err != ErrEmpty {
+		t.Errorf("pop empty queue: have %v, want %v", err, ErrEmpty)
+	}
+
+	size := 2 * blockSize
+	for i := 0; i < size; i++ {
+		if err := queue.Push(i); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if _, err := queue.Pop(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if queue.Size() != size/2 {
+		t.Errorf("size mismatch: have %v, want %v.", queue.Size(), size/2)
+	}
+
+	items, err := queue.Peek(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items {
+		if item != size/2+i {
+			t.Errorf("peek mismatch: have %v, want %v.", item, size/2+i)
+		}
+	}
+	if queue.Size() != size/2 {
+		t.Errorf("size changed after peek: have %v, want %v.", queue.Size(), size/2)
+	}
+
+	for i := size / 2; i < size; i++ {
+		data, err := queue.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != i {
+			t.Errorf("push/pop mismatch: have %v, want %v.", data, i)
+		}
+	}
+	if !queue.Empty() {
+		t.Errorf("queue not empty after pop all: %v", queue.Size())
+	}
+}
+
+func TestDurableQueueRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := OpenDurable(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		queue.Push(i)
+	}
+	queue.Pop()
+	queue.Close()
+
+	queue, err = OpenDurable(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if queue.Size() != 9 {
+		t.Errorf("size mismatch after restore: have %v, want %v.", queue.Size(), 9)
+	}
+	queue.Push(10)
+	for i := 1; i <= 10; i++ {
+		data, err := queue.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != i {
+			t.Errorf("restore mismatch: have %v, want %v.", data, i)
+		}
+	}
+
+	queue.Push(0)
+	if err := queue.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if !queue.Empty() {
+		t.Errorf("queue not empty after reset: %v", queue.Size())
+	}
+}
+
+func TestDurableQueueCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := OpenDurable(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		queue.Push(i)
+	}
+	for _, seq := range []uint64{1, 3} {
+		if err := queue.db.Put(seqKey(seq), []byte("corrupt"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the corrupt element stops the peek, and is moved aside once it is the first
+	if items, err := queue.Peek(5); err != nil || len(items) != 1 || items[0] != 0 {
+		t.Errorf("peek mismatch: have %v %v, want [0]", items, err)
+	}
+	for _, want := range []int{0, 2} {
+		if data, err := queue.Pop(); err != nil || data != want {
+			t.Errorf("pop mismatch: have %v %v, want %v", data, err, want)
+		}
+	}
+	if data, err := queue.Front(); err != nil || data != 4 {
+		t.Errorf("front mismatch: have %v %v, want %v", data, err, 4)
+	}
+	if queue.Size() != 1 || queue.Corrupted() != 2 {
+		t.Errorf("size %d and corrupted %d mismatch, want 1 and 2", queue.Size(), queue.Corrupted())
+	}
+	queue.Close()
+
+	// the elements moved aside are kept apart from the queue
+	queue, err = OpenDurable(dir, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if queue.Size() != 1 {
+		t.Errorf("size mismatch after restore: have %v, want %v.", queue.Size(), 1)
+	}
+	queue.Push(5)
+	for _, want := range []int{4, 5} {
+		if data, err := queue.Pop(); err != nil || data != want {
+			t.Errorf("pop mismatch after restore: have %v %v, want %v", data, err, want)
+		}
+	}
+	if _, err := queue.Pop(); err != ErrEmpty {
+		t.Errorf("pop empty queue: have %v, want %v", err, ErrEmpty)
+	}
+}